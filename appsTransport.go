@@ -1,15 +1,20 @@
 package ghinstallation
 
 import (
+	"context"
 	"crypto/rsa"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v88/github"
 )
 
 // AppsTransport provides a http.RoundTripper by wrapping an existing
@@ -23,6 +28,7 @@ import (
 type AppsTransport struct {
 	BaseURL string            // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
 	Client  Client            // Client to use to refresh tokens, defaults to http.Client with provided transport
+	Clock   Clock             // Clock provides the current time for JWT claims, defaults to the system clock
 	tr      http.RoundTripper // tr is the underlying roundtripper being wrapped
 	signer  Signer            // signer signs JWT tokens.
 	appID   int64             // appID is the GitHub App's ID
@@ -39,14 +45,15 @@ func NewAppsTransportKeyFromFile(tr http.RoundTripper, appID int64, privateKeyFi
 }
 
 // NewAppsTransport returns a AppsTransport using private key. The key is parsed
-// and if any errors occur the error is non-nil.
+// and if any errors occur the error is non-nil. See ParsePrivateKey for the
+// supported key formats.
 //
 // The provided tr http.RoundTripper should be shared between multiple
 // installations to ensure reuse of underlying TCP connections.
 //
 // The returned Transport's RoundTrip method is safe to be used concurrently.
 func NewAppsTransport(tr http.RoundTripper, appID int64, privateKey []byte) (*AppsTransport, error) {
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
+	key, err := ParsePrivateKey(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse private key: %s", err)
 	}
@@ -84,27 +91,136 @@ func NewAppsTransportWithOptions(tr http.RoundTripper, appID int64, opts ...Apps
 
 // RoundTrip implements http.RoundTripper interface.
 func (t *AppsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rs, ok := t.signer.(*RotatingSigner); ok {
+		return t.roundTripRotating(req, rs)
+	}
+
+	ss, err := t.JWT()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+ss.Reveal())
+	req.Header.Add("Accept", acceptHeader)
+
+	resp, err := t.tr.RoundTrip(req)
+	return resp, err
+}
+
+// roundTripRotating sends req with a JWT signed by each of rs's keys in turn,
+// until GitHub accepts the JWT or there are no keys left.
+func (t *AppsTransport) roundTripRotating(req *http.Request, rs *RotatingSigner) (*http.Response, error) {
+	claims := t.claims()
+	for i := 0; ; i++ {
+		ss, err := rs.signWith(i, claims)
+		if err != nil {
+			return nil, fmt.Errorf("could not sign jwt: %s", err)
+		}
+
+		r := req
+		if i == 0 {
+			req.Header.Add("Accept", acceptHeader)
+		} else {
+			r = cloneRequest(req)
+			if req.GetBody != nil {
+				if r.Body, err = req.GetBody(); err != nil {
+					return nil, fmt.Errorf("could not rewind request body: %s", err)
+				}
+			}
+		}
+		r.Header.Set("Authorization", "Bearer "+ss)
+
+		resp, err := t.tr.RoundTrip(r)
+		if err != nil {
+			return resp, err
+		}
+		rejected := resp.StatusCode == http.StatusUnauthorized
+		rs.record(i, !rejected)
+
+		canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if !rejected || i == len(rs.keys)-1 || !canRetry {
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// JWT returns a newly signed JWT authenticating as the GitHub App, for use with
+// other HTTP clients.
+func (t *AppsTransport) JWT() (Secret, error) {
+	ss, err := t.signer.Sign(t.claims())
+	if err != nil {
+		return "", fmt.Errorf("could not sign jwt: %s", err)
+	}
+	return Secret(ss), nil
+}
+
+// claims returns the claims of a JWT authenticating as the GitHub App.
+func (t *AppsTransport) claims() *jwt.RegisteredClaims {
 	// GitHub rejects expiry and issue timestamps that are not an integer,
 	// while the jwt-go library serializes to fractional timestamps.
 	// Truncate them before passing to jwt-go.
-	iss := time.Now().Add(-30 * time.Second).Truncate(time.Second)
+	iss := now(t.Clock).Add(-30 * time.Second).Truncate(time.Second)
 	exp := iss.Add(2 * time.Minute)
-	claims := &jwt.RegisteredClaims{
+	return &jwt.RegisteredClaims{
 		IssuedAt:  jwt.NewNumericDate(iss),
 		ExpiresAt: jwt.NewNumericDate(exp),
 		Issuer:    strconv.FormatInt(t.appID, 10),
 	}
+}
+
+// AppIdentity is the expected identity of a GitHub App, checked by
+// AppsTransport.Verify. Empty fields are not checked.
+type AppIdentity struct {
+	Slug  string // Slug is the app's URL-friendly name
+	Owner string // Owner is the login of the user or organization owning the app
+}
 
-	ss, err := t.signer.Sign(claims)
+// Verify fetches the GitHub App authenticated by the transport's JWT, and
+// returns an error if GitHub rejects the JWT, or the app does not match the
+// transport's app ID or want. Call Verify at startup to fail fast when a
+// private key and app ID do not belong together.
+func (t *AppsTransport) Verify(ctx context.Context, want AppIdentity) (*github.App, error) {
+	requestURL := strings.TrimRight(t.BaseURL, "/") + "/app"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not sign jwt: %s", err)
+		return nil, fmt.Errorf("could not create request: %s", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+ss)
-	req.Header.Add("Accept", acceptHeader)
+	resp, err := t.RoundTrip(req)
+	e := &HTTPError{
+		RootCause: err,
+		Response:  redactResponse(resp),
+	}
+	if err != nil {
+		e.Message = fmt.Sprintf("could not get app from GitHub API for app ID %v: %v", t.appID, err)
+		return nil, e
+	}
+	defer resp.Body.Close()
 
-	resp, err := t.tr.RoundTrip(req)
-	return resp, err
+	if resp.StatusCode == http.StatusUnauthorized {
+		e.Message = fmt.Sprintf("GitHub rejected the JWT for app ID %v with status %q: the private key does not belong to the app, or the app ID is incorrect", t.appID, resp.Status)
+		return nil, e
+	}
+	if resp.StatusCode/100 != 2 {
+		e.Message = fmt.Sprintf("received non 2xx response status %q when fetching %v", resp.Status, req.URL)
+		return nil, e
+	}
+
+	var app github.App
+	if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
+		return nil, fmt.Errorf("could not decode app: %w", err)
+	}
+	switch {
+	case app.GetID() != t.appID:
+		return &app, fmt.Errorf("authenticated as app ID %v, expected app ID %v", app.GetID(), t.appID)
+	case want.Slug != "" && !strings.EqualFold(app.GetSlug(), want.Slug):
+		return &app, fmt.Errorf("app ID %v has slug %q, expected %q", t.appID, app.GetSlug(), want.Slug)
+	case want.Owner != "" && !strings.EqualFold(app.GetOwner().GetLogin(), want.Owner):
+		return &app, fmt.Errorf("app ID %v is owned by %q, expected %q", t.appID, app.GetOwner().GetLogin(), want.Owner)
+	}
+	return &app, nil
 }
 
 // AppID returns the appID of the transport
@@ -114,6 +230,14 @@ func (t *AppsTransport) AppID() int64 {
 
 type AppsTransportOption func(*AppsTransport)
 
+// WithClock configures the AppsTransport to use the given Clock for the JWT
+// claims. Transports created by NewFromAppsTransport use the same Clock.
+func WithClock(clock Clock) AppsTransportOption {
+	return func(at *AppsTransport) {
+		at.Clock = clock
+	}
+}
+
 // WithSigner configures the AppsTransport to use the given Signer for generating JWT tokens.
 func WithSigner(signer Signer) AppsTransportOption {
 	return func(at *AppsTransport) {
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/google/go-cmp/cmp"
@@ -140,3 +141,96 @@ type noopSigner struct{}
 func (noopSigner) Sign(jwt.Claims) (string, error) {
 	return "hunter2", nil
 }
+
+func TestVerify(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/app" {
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+		}
+		ss := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, err := jwt.Parse(ss, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil }); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, `{"message":"A JSON web token could not be decoded"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id":%d,"slug":"my-app","owner":{"login":"my-org"}}`, appID)
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		name    string
+		appID   int64
+		signer  Signer
+		want    AppIdentity
+		wantErr string
+	}{
+		{name: "match", appID: appID, want: AppIdentity{Slug: "my-app", Owner: "My-Org"}},
+		{name: "no expectations", appID: appID},
+		{name: "app ID", appID: 3, wantErr: "authenticated as app ID 2, expected app ID 3"},
+		{name: "slug", appID: appID, want: AppIdentity{Slug: "other-app"}, wantErr: `has slug "my-app", expected "other-app"`},
+		{name: "owner", appID: appID, want: AppIdentity{Owner: "other-org"}, wantErr: `is owned by "my-org", expected "other-org"`},
+		{name: "wrong key", appID: appID, signer: noopSigner{}, wantErr: "private key does not belong to the app"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			signer := tc.signer
+			if signer == nil {
+				signer = NewRSASigner(jwt.SigningMethodRS256, key)
+			}
+			tr, err := NewAppsTransportWithOptions(&http.Transport{}, tc.appID, WithSigner(signer))
+			if err != nil {
+				t.Fatalf("NewAppsTransportWithOptions: %v", err)
+			}
+			tr.BaseURL = ts.URL + "/api/v3/"
+
+			app, err := tr.Verify(t.Context(), tc.want)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if app.GetSlug() != "my-app" {
+					t.Errorf("slug got: %q want: %q", app.GetSlug(), "my-app")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("error got: %v want containing: %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTClock(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 500, time.UTC)}
+	tr, err := NewAppsTransportWithOptions(http.DefaultTransport, appID, WithSigner(NewRSASigner(jwt.SigningMethodRS256, key)), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := tr.JWT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(ss.Reveal(), &claims); err != nil {
+		t.Fatal(err)
+	}
+	wantIat := time.Date(2023, 12, 31, 23, 59, 30, 0, time.UTC)
+	if !claims.IssuedAt.Equal(wantIat) {
+		t.Errorf("iat got: %v want: %v", claims.IssuedAt, wantIat)
+	}
+	if want := wantIat.Add(2 * time.Minute); !claims.ExpiresAt.Equal(want) {
+		t.Errorf("exp got: %v want: %v", claims.ExpiresAt, want)
+	}
+
+	if itr := NewFromAppsTransport(tr, installationID); itr.Clock != clock {
+		t.Error("NewFromAppsTransport did not use the AppsTransport's Clock")
+	}
+}
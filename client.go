@@ -0,0 +1,87 @@
+package ghinstallation
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxRedirects is the number of redirects followed, matching net/http's
+// default policy.
+const maxRedirects = 10
+
+// NewHTTPClient returns an *http.Client authenticating requests using t, which
+// follows redirects without leaking the installation token. The token is sent
+// on same-origin redirects, such as those for renamed repositories, but
+// withheld on cross-origin redirects, such as to codeload.github.com or
+// objects.githubusercontent.com when downloading archives and release assets.
+func NewHTTPClient(t *Transport) *http.Client {
+	return &http.Client{
+		Transport:     &redirectTransport{t: t},
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// redirectTransport authenticates requests using Transport, except for
+// cross-origin redirects which are sent using Transport's underlying
+// http.RoundTripper.
+type redirectTransport struct {
+	t *Transport
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (rt *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// req.Response is only set for requests created by following a redirect.
+	if req.Response != nil && !sameOrigin(req.URL, initialRequest(req).URL) {
+		return rt.t.tr.RoundTrip(req)
+	}
+	return rt.t.RoundTrip(req)
+}
+
+// checkRedirect is the redirect policy of clients returned by NewHTTPClient.
+// Redirects are limited to maxRedirects, must not downgrade from HTTPS, and any
+// Authorization header set by the caller is dropped on cross-origin redirects.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	if strings.EqualFold(via[len(via)-1].URL.Scheme, "https") && !strings.EqualFold(req.URL.Scheme, "https") {
+		return errors.New("refusing to follow redirect from https to " + req.URL.Scheme)
+	}
+	if !sameOrigin(req.URL, via[0].URL) {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// initialRequest returns the request which led to req being sent, following
+// any redirects.
+func initialRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+	return req
+}
+
+// sameOrigin reports whether a and b have the same scheme, host and port.
+func sameOrigin(a, b *url.URL) bool {
+	return origin(a) == origin(b)
+}
+
+// origin returns the scheme, host and port of u, using the scheme's default
+// port if none is set.
+func origin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" {
+		switch scheme {
+		case "https":
+			port = "443"
+		case "http":
+			port = "80"
+		}
+	}
+	return scheme + "://" + net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
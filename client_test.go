@@ -0,0 +1,97 @@
+package ghinstallation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientRedirects(t *testing.T) {
+	downloads := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("cross-origin redirect got Authorization header: %q", auth)
+		}
+	}))
+	defer downloads.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := "token " + token; r.Header.Get("Authorization") != want {
+			t.Errorf("%s Authorization got: %q want: %q", r.URL.Path, r.Header.Get("Authorization"), want)
+		}
+		switch r.URL.Path {
+		case "/repos/o/old":
+			http.Redirect(w, r, "/repos/o/new", http.StatusMovedPermanently)
+		case "/repos/o/new":
+		case "/repos/o/new/zipball":
+			http.Redirect(w, r, downloads.URL+"/o/new/zip", http.StatusFound)
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+		}
+	}))
+	defer api.Close()
+
+	tr := &Transport{
+		BaseURL: api.URL,
+		token: &accessToken{
+			ExpiresAt: time.Now().Add(1 * time.Hour),
+			Token:     token,
+		},
+		mu: &sync.Mutex{},
+		tr: &http.Transport{},
+	}
+	client := NewHTTPClient(tr)
+
+	for _, path := range []string{"/repos/o/old", "/repos/o/new/zipball"} {
+		resp, err := client.Get(api.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error from client for %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s status got: %d want: %d", path, resp.StatusCode, http.StatusOK)
+		}
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	via := func(urls ...string) []*http.Request {
+		var reqs []*http.Request
+		for _, u := range urls {
+			reqs = append(reqs, httptest.NewRequest("GET", u, nil))
+		}
+		return reqs
+	}
+
+	req := httptest.NewRequest("GET", "http://api.github.com/", nil)
+	if err := checkRedirect(req, via("https://api.github.com/")); err == nil {
+		t.Error("expected error redirecting from https to http")
+	}
+
+	req = httptest.NewRequest("GET", "https://codeload.github.com/", nil)
+	req.Header.Set("Authorization", "token "+token)
+	if err := checkRedirect(req, via("https://api.github.com/")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		t.Errorf("cross-origin redirect got Authorization header: %q", auth)
+	}
+
+	req = httptest.NewRequest("GET", "https://api.github.com:443/repositories/1", nil)
+	req.Header.Set("Authorization", "token "+token)
+	if err := checkRedirect(req, via("https://api.github.com/")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth := req.Header.Get("Authorization"); auth == "" {
+		t.Error("same-origin redirect missing Authorization header")
+	}
+
+	reqs := make([]string, maxRedirects)
+	for i := range reqs {
+		reqs[i] = "https://api.github.com/"
+	}
+	if err := checkRedirect(req, via(reqs...)); err == nil {
+		t.Error("expected error after too many redirects")
+	}
+}
@@ -0,0 +1,19 @@
+package ghinstallation
+
+import "time"
+
+// Clock provides the current time. Transports use it to determine when
+// installation tokens need refreshing and to set the lifetime of JWTs,
+// allowing tests to simulate the passage of time without sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// now returns the current time according to clock, or the system clock if
+// clock is nil.
+func now(clock Clock) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
@@ -0,0 +1,303 @@
+// Command git-credential-ghinstallation is a git credential helper providing
+// GitHub App installation tokens, so git can clone and push to repositories
+// the installation can access without writing tokens into URLs.
+//
+// Configure git to use the helper for GitHub:
+//
+//	git config --global credential.https://github.com.helper \
+//		"ghinstallation -app-id 1 -installation-id 99 -key-file /path/to/key.pem"
+//
+// Flags default to the environment variables GHINSTALLATION_APP_ID,
+// GHINSTALLATION_INSTALLATION_ID, GHINSTALLATION_KEY_FILE,
+// GHINSTALLATION_BASE_URL, GHINSTALLATION_SCOPE_REPOSITORY and
+// GHINSTALLATION_CACHE_DIR.
+//
+// With -scope-repository and git's credential.useHttpPath set, tokens are
+// restricted to the repository being accessed. Tokens are cached in the user's
+// cache directory between invocations, and are removed from the cache when git
+// reports they were rejected.
+//
+// See https://git-scm.com/docs/gitcredentials
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v88/github"
+)
+
+const (
+	// username is the username git authenticates with alongside an
+	// installation token.
+	username = "x-access-token"
+	// minTokenLifetime is the minimum remaining lifetime of a cached token,
+	// so tokens do not expire during long running git operations.
+	minTokenLifetime = 10 * time.Minute
+)
+
+// config is the helper's configuration, from flags or the environment.
+type config struct {
+	appID           int64
+	installationID  int64
+	keyFile         string
+	baseURL         string
+	scopeRepository bool
+	cacheDir        string
+}
+
+// cachedToken is an installation token cached between invocations.
+type cachedToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv); err != nil {
+		fmt.Fprintf(os.Stderr, "git-credential-ghinstallation: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the helper with the command line args, reading the credential
+// description from stdin and writing the credential to stdout.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) error {
+	cfg, action, err := parseFlags(args, stderr, getenv)
+	if err != nil {
+		return err
+	}
+	attrs, err := readAttributes(stdin)
+	if err != nil {
+		return err
+	}
+
+	host := gitHost(cfg.baseURL)
+	if host == "" || !strings.EqualFold(attrs["host"], host) {
+		// Not a credential for this GitHub host, leave it to other helpers.
+		return nil
+	}
+	repo := ""
+	if cfg.scopeRepository {
+		repo = repository(attrs["path"])
+	}
+
+	switch action {
+	case "get":
+		token, err := cfg.token(ctx, host, repo)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "username=%s\npassword=%s\npassword_expiry_utc=%d\n", username, token.Token, token.ExpiresAt.Unix())
+		return err
+	case "erase":
+		if cfg.cacheDir == "" {
+			return nil
+		}
+		if err := os.Remove(cfg.cacheFile(host, repo)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove cached token: %w", err)
+		}
+		return nil
+	case "store":
+		// Tokens are cached when created by get.
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q, expected get, store or erase", action)
+	}
+}
+
+// parseFlags parses the command line args, returning the configuration and
+// the action requested by git.
+func parseFlags(args []string, stderr io.Writer, getenv func(string) string) (*config, string, error) {
+	cfg := &config{}
+	fs := flag.NewFlagSet("git-credential-ghinstallation", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Int64Var(&cfg.appID, "app-id", envInt(getenv, "GHINSTALLATION_APP_ID"), "GitHub App ID")
+	fs.Int64Var(&cfg.installationID, "installation-id", envInt(getenv, "GHINSTALLATION_INSTALLATION_ID"), "GitHub App installation ID")
+	fs.StringVar(&cfg.keyFile, "key-file", getenv("GHINSTALLATION_KEY_FILE"), "path to the GitHub App's private key")
+	fs.StringVar(&cfg.baseURL, "base-url", envOr(getenv, "GHINSTALLATION_BASE_URL", "https://api.github.com"), "GitHub API base URL, such as https://github.example.com/api/v3 for GitHub Enterprise Server")
+	fs.BoolVar(&cfg.scopeRepository, "scope-repository", getenv("GHINSTALLATION_SCOPE_REPOSITORY") == "true", "restrict tokens to the repository being accessed, requires credential.useHttpPath")
+	fs.StringVar(&cfg.cacheDir, "cache-dir", envOr(getenv, "GHINSTALLATION_CACHE_DIR", defaultCacheDir()), "directory caching tokens between invocations, or empty to disable caching")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: git-credential-ghinstallation [flags] get|store|erase")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil, "", errors.New("expected a single action")
+	}
+	switch {
+	case cfg.appID == 0:
+		return nil, "", errors.New("app ID is required")
+	case cfg.installationID == 0:
+		return nil, "", errors.New("installation ID is required")
+	case cfg.keyFile == "":
+		return nil, "", errors.New("key file is required")
+	}
+	return cfg, fs.Arg(0), nil
+}
+
+// readAttributes reads the attributes of a credential description, one
+// key=value pair per line, until a blank line or EOF.
+func readAttributes(r io.Reader) (map[string]string, error) {
+	attrs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			attrs[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read credential description: %w", err)
+	}
+	return attrs, nil
+}
+
+// gitHost returns the host git uses for the GitHub instance with the API at
+// baseURL, such as github.com for https://api.github.com.
+func gitHost(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Host, "api.")
+}
+
+// repository returns the name of the repository at path, such as
+// octo-org/hello-world.git, or empty if path is not a repository.
+func repository(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		return ""
+	}
+	return strings.TrimSuffix(parts[1], ".git")
+}
+
+// token returns a cached installation token for host and repo, or creates one
+// if none is cached or the cached token expires soon.
+func (cfg *config) token(ctx context.Context, host, repo string) (*cachedToken, error) {
+	if cfg.cacheDir != "" {
+		if token, ok := cfg.cachedToken(host, repo); ok {
+			return token, nil
+		}
+	}
+
+	tr, err := ghinstallation.NewKeyFromFile(http.DefaultTransport, cfg.appID, cfg.installationID, cfg.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tr.BaseURL = cfg.baseURL
+	if repo != "" {
+		tr.InstallationTokenOptions = &github.InstallationTokenOptions{Repositories: []string{repo}}
+	}
+	secret, err := tr.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt, _, err := tr.Expiry()
+	if err != nil {
+		return nil, err
+	}
+	token := &cachedToken{Token: secret, ExpiresAt: expiresAt}
+
+	if cfg.cacheDir != "" {
+		if err := cfg.cacheToken(host, repo, token); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// cachedToken returns the cached token for host and repo, if it does not
+// expire soon.
+func (cfg *config) cachedToken(host, repo string) (*cachedToken, bool) {
+	//nolint:gosec // G304: Path is derived from the cache directory
+	data, err := os.ReadFile(cfg.cacheFile(host, repo))
+	if err != nil {
+		return nil, false
+	}
+	var token cachedToken
+	if err := json.Unmarshal(data, &token); err != nil || token.Token == "" || time.Until(token.ExpiresAt) < minTokenLifetime {
+		return nil, false
+	}
+	return &token, true
+}
+
+// cacheToken caches token for host and repo, readable only by the user.
+func (cfg *config) cacheToken(host, repo string, token *cachedToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.cacheDir, 0o700); err != nil {
+		return fmt.Errorf("could not create cache directory: %w", err)
+	}
+	// Write to a temporary file and rename it, so concurrent invocations never
+	// read a partially written token.
+	f, err := os.CreateTemp(cfg.cacheDir, ".token-*")
+	if err != nil {
+		return fmt.Errorf("could not cache token: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("could not cache token: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not cache token: %w", err)
+	}
+	if err := os.Rename(f.Name(), cfg.cacheFile(host, repo)); err != nil {
+		return fmt.Errorf("could not cache token: %w", err)
+	}
+	return nil
+}
+
+// cacheFile returns the path of the file caching the token for host and repo.
+func (cfg *config) cacheFile(host, repo string) string {
+	key := fmt.Sprintf("%s\n%d\n%d\n%s\n%s", cfg.baseURL, cfg.appID, cfg.installationID, strings.ToLower(host), strings.ToLower(repo))
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(cfg.cacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// defaultCacheDir returns the directory caching tokens within the user's cache
+// directory, or empty if there is none.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ghinstallation")
+}
+
+func envOr(getenv func(string) string, key, fallback string) string {
+	if v := getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(getenv func(string) string, key string) int64 {
+	v, _ := strconv.ParseInt(getenv(key), 10, 64)
+	return v
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2/ghinstallationtest"
+)
+
+func TestCredentialHelper(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := ghinstallationtest.NewServer()
+	defer srv.Close()
+	srv.AddApp(ghinstallationtest.App{ID: 1, Slug: "test-app", Owner: "octo-org", PublicKey: &key.PublicKey})
+	srv.AddInstallation(ghinstallationtest.Installation{
+		ID:           99,
+		AppID:        1,
+		Account:      "octo-org",
+		Repositories: []ghinstallationtest.Repository{{ID: 10, Name: "hello-world"}, {ID: 11, Name: "spoon-knife"}},
+	})
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"GHINSTALLATION_APP_ID":          "1",
+		"GHINSTALLATION_INSTALLATION_ID": "99",
+		"GHINSTALLATION_KEY_FILE":        keyFile,
+		"GHINSTALLATION_CACHE_DIR":       filepath.Join(dir, "cache"),
+	}
+	helper := func(input string, args ...string) map[string]string {
+		t.Helper()
+		var stdout bytes.Buffer
+		args = append([]string{"-base-url", srv.URL}, args...)
+		if err := run(context.Background(), args, strings.NewReader(input), &stdout, io.Discard, func(key string) string { return env[key] }); err != nil {
+			t.Fatal(err)
+		}
+		attrs, err := readAttributes(&stdout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return attrs
+	}
+	request := "protocol=https\nhost=" + u.Host + "\npath=octo-org/hello-world.git\n\n"
+
+	got := helper(request, "get")
+	if got["username"] != "x-access-token" || got["password"] == "" || got["password_expiry_utc"] == "" {
+		t.Fatalf("get got: %v", got)
+	}
+	if tokens := srv.Tokens(99); len(tokens) != 1 || tokens[0].Token != got["password"] || len(tokens[0].Repositories) != 2 {
+		t.Fatalf("server tokens got: %+v", tokens)
+	}
+
+	if cached := helper(request, "get"); cached["password"] != got["password"] {
+		t.Errorf("expected cached token %q, got: %q", got["password"], cached["password"])
+	}
+	if n := len(srv.Tokens(99)); n != 1 {
+		t.Errorf("expected cached token to be used, server created %d tokens", n)
+	}
+
+	helper(request, "store")
+	helper(request, "erase")
+	if erased := helper(request, "get"); erased["password"] == got["password"] || erased["password"] == "" {
+		t.Errorf("expected new token after erase, got: %v", erased)
+	}
+
+	scoped := helper(request, "-scope-repository", "get")
+	for _, token := range srv.Tokens(99) {
+		if token.Token == scoped["password"] && (len(token.Repositories) != 1 || token.Repositories[0].Name != "hello-world") {
+			t.Errorf("expected token scoped to hello-world, got: %v", token.Repositories)
+		}
+	}
+	if scoped["password"] == got["password"] {
+		t.Errorf("expected a new token scoped to hello-world")
+	}
+
+	if other := helper("protocol=https\nhost=gitlab.com\n\n", "get"); len(other) != 0 {
+		t.Errorf("expected no credential for another host, got: %v", other)
+	}
+}
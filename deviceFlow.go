@@ -0,0 +1,159 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultDeviceInterval is the default minimum time between polls of the
+	// device flow.
+	defaultDeviceInterval = 5 * time.Second
+	// slowDownIncrement is added to the polling interval when GitHub responds
+	// with slow_down.
+	slowDownIncrement = 5 * time.Second
+)
+
+// ErrDeviceCodeExpired is returned when the user did not authorize a device
+// before its device code expired. Start the device flow again.
+var ErrDeviceCodeExpired = errors.New("device code expired")
+
+// DeviceAuthorization is a pending authorization of a device by a user,
+// returned by DeviceFlow.Start. Show the user UserCode and ask them to enter
+// it at VerificationURI, then call DeviceFlow.Poll.
+type DeviceAuthorization struct {
+	DeviceCode      Secret        // DeviceCode identifies the authorization when polling
+	UserCode        string        // UserCode is the code the user enters at VerificationURI
+	VerificationURI string        // VerificationURI is where the user authorizes the device, such as https://github.com/login/device
+	ExpiresAt       time.Time     // ExpiresAt is when DeviceCode and UserCode expire
+	Interval        time.Duration // Interval is the minimum time between polls
+}
+
+// DeviceFlow authorizes a GitHub App to act as a user using the OAuth device
+// flow, suitable for CLIs and other applications without a browser redirect.
+// The resulting UserToken can be used with a UserTransport.
+//
+// See https://docs.github.com/en/apps/creating-github-apps/writing-code-for-a-github-app/building-a-cli-with-a-github-app
+type DeviceFlow struct {
+	ClientID string                                           // ClientID is the GitHub App's client ID
+	WebURL   string                                           // WebURL is the scheme and host of GitHub's OAuth endpoints, defaults to https://github.com
+	Client   Client                                           // Client sends requests to GitHub, defaults to http.DefaultClient
+	Clock    Clock                                            // Clock provides the current time, defaults to the system clock
+	Sleep    func(ctx context.Context, d time.Duration) error // Sleep waits between polls, defaults to waiting for d or until ctx is done
+}
+
+// NewDeviceFlow returns a DeviceFlow for the GitHub App with clientID.
+func NewDeviceFlow(clientID string) *DeviceFlow {
+	return &DeviceFlow{
+		ClientID: clientID,
+		WebURL:   webBaseURL,
+		Client:   http.DefaultClient,
+	}
+}
+
+// deviceCodeResponse is a response from GitHub's device code endpoint.
+type deviceCodeResponse struct {
+	OAuthError
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+}
+
+// Start requests a device and user code, starting the device flow.
+func (f *DeviceFlow) Start(ctx context.Context) (*DeviceAuthorization, error) {
+	var resp deviceCodeResponse
+	if err := postOAuth(ctx, f.client(), f.WebURL, "/login/device/code", url.Values{"client_id": {f.ClientID}}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.DeviceCode == "" || resp.UserCode == "" {
+		return nil, &HTTPError{Message: "/login/device/code response contains no device code"}
+	}
+	auth := &DeviceAuthorization{
+		DeviceCode:      Secret(resp.DeviceCode),
+		UserCode:        resp.UserCode,
+		VerificationURI: resp.VerificationURI,
+		ExpiresAt:       now(f.Clock).Add(time.Duration(resp.ExpiresIn) * time.Second),
+		Interval:        time.Duration(resp.Interval) * time.Second,
+	}
+	if auth.Interval <= 0 {
+		auth.Interval = defaultDeviceInterval
+	}
+	return auth, nil
+}
+
+// Poll waits for the user to authorize the device, polling GitHub at the
+// authorization's interval, and returns the user's token. Poll slows down when
+// asked to by GitHub, and returns ErrDeviceCodeExpired if the authorization
+// expires, or an error wrapping an *OAuthError if the user denies it.
+func (f *DeviceFlow) Poll(ctx context.Context, auth *DeviceAuthorization) (*UserToken, error) {
+	interval := auth.Interval
+	if interval <= 0 {
+		interval = defaultDeviceInterval
+	}
+	form := url.Values{
+		"client_id":   {f.ClientID},
+		"device_code": {auth.DeviceCode.Reveal()},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+
+	for {
+		if !now(f.Clock).Before(auth.ExpiresAt) {
+			return nil, ErrDeviceCodeExpired
+		}
+		if err := f.sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+
+		var resp oauthTokenResponse
+		err := postOAuth(ctx, f.client(), f.WebURL, "/login/oauth/access_token", form, &resp)
+		var oauthErr *OAuthError
+		switch {
+		case err == nil && resp.AccessToken != "":
+			return resp.userToken(now(f.Clock)), nil
+		case err == nil:
+			return nil, &HTTPError{Message: "/login/oauth/access_token response contains no access token"}
+		case !errors.As(err, &oauthErr):
+			return nil, err
+		}
+		switch oauthErr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += slowDownIncrement
+			if resp.Interval > 0 {
+				interval = time.Duration(resp.Interval) * time.Second
+			}
+		case "expired_token":
+			return nil, fmt.Errorf("%w: %w", ErrDeviceCodeExpired, err)
+		default:
+			return nil, err
+		}
+	}
+}
+
+func (f *DeviceFlow) client() Client {
+	if f.Client == nil {
+		return http.DefaultClient
+	}
+	return f.Client
+}
+
+// sleep waits for d using Sleep, or until ctx is done.
+func (f *DeviceFlow) sleep(ctx context.Context, d time.Duration) error {
+	if f.Sleep != nil {
+		return f.Sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,116 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeviceFlow(t *testing.T) {
+	responses := []string{
+		`{"error":"authorization_pending"}`,
+		`{"error":"slow_down","interval":10}`,
+		`{"error":"authorization_pending"}`,
+		`{"access_token":"ghu_abc","expires_in":28800,"refresh_token":"ghr_abc","refresh_token_expires_in":15897600,"token_type":"bearer"}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("client_id") != "Iv1.abc" {
+			t.Errorf("client_id got: %q want: %q", r.PostForm.Get("client_id"), "Iv1.abc")
+		}
+		switch r.URL.Path {
+		case "/login/device/code":
+			fmt.Fprint(w, `{"device_code":"3584d83530557fdd1f46af8289938c8ef79f9dc5","user_code":"WDJB-MJHT","verification_uri":"https://github.com/login/device","expires_in":900,"interval":5}`)
+		case "/login/oauth/access_token":
+			if r.PostForm.Get("device_code") != "3584d83530557fdd1f46af8289938c8ef79f9dc5" || r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:device_code" {
+				t.Errorf("unexpected poll: %v", r.PostForm)
+			}
+			fmt.Fprint(w, responses[0])
+			responses = responses[1:]
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var slept []time.Duration
+	flow := NewDeviceFlow("Iv1.abc")
+	flow.WebURL = ts.URL
+	flow.Clock = clock
+	flow.Sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		clock.Advance(d)
+		return nil
+	}
+
+	auth, err := flow.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.UserCode != "WDJB-MJHT" || auth.Interval != 5*time.Second || !auth.ExpiresAt.Equal(clock.Now().Add(15*time.Minute)) {
+		t.Errorf("DeviceAuthorization got: %+v", auth)
+	}
+
+	token, err := flow.Poll(context.Background(), auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken.Reveal() != "ghu_abc" || token.RefreshToken.Reveal() != "ghr_abc" || !token.ExpiresAt.Equal(clock.Now().Add(8*time.Hour)) {
+		t.Errorf("UserToken got: %+v", token)
+	}
+	if want := []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second, 10 * time.Second}; fmt.Sprint(slept) != fmt.Sprint(want) {
+		t.Errorf("slept got: %v want: %v", slept, want)
+	}
+}
+
+func TestDeviceFlowErrors(t *testing.T) {
+	var response string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, response)
+	}))
+	defer ts.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	flow := NewDeviceFlow("Iv1.abc")
+	flow.WebURL = ts.URL
+	flow.Clock = clock
+	flow.Sleep = func(_ context.Context, d time.Duration) error {
+		clock.Advance(d)
+		return nil
+	}
+	auth := &DeviceAuthorization{DeviceCode: "code", ExpiresAt: clock.Now().Add(time.Minute), Interval: 5 * time.Second}
+
+	response = `{"error":"access_denied","error_description":"The authorization request was denied."}`
+	_, err := flow.Poll(context.Background(), auth)
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "access_denied" {
+		t.Errorf("expected OAuthError access_denied, got: %v", err)
+	}
+
+	response = `{"error":"expired_token"}`
+	if _, err := flow.Poll(context.Background(), auth); !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Errorf("expected ErrDeviceCodeExpired, got: %v", err)
+	}
+
+	// The authorization expires while pending.
+	response = `{"error":"authorization_pending"}`
+	if _, err := flow.Poll(context.Background(), auth); !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Errorf("expected ErrDeviceCodeExpired while pending, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	flow.Sleep = nil
+	auth.ExpiresAt = time.Now().Add(time.Hour)
+	flow.Clock = nil
+	if _, err := flow.Poll(ctx, auth); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// SignAPIVersion is the version of the protocol used by external signers.
+	SignAPIVersion = "ghinstallation/v1"
+
+	// defaultExecTimeout is how long an ExecSigner's command may run.
+	defaultExecTimeout = 10 * time.Second
+	// tokenReuseMargin is how long before expiry a cached JWT is no longer
+	// reused.
+	tokenReuseMargin = 30 * time.Second
+	// maxExecOutput limits how much of a command's stdout and stderr is read.
+	maxExecOutput = 1 << 20
+)
+
+// SignRequest is a request for an external signer to sign a JWT. It is
+// written as JSON to the stdin of an ExecSigner's command, and sent as the
+// body of a RemoteSigner's request.
+type SignRequest struct {
+	APIVersion string          `json:"apiVersion"` // APIVersion is SignAPIVersion
+	Claims     json.RawMessage `json:"claims"`     // Claims are the JWT claims to sign, such as iss, iat and exp
+}
+
+// SignResponse is the response of an external signer. Exactly one of Token or
+// Error must be set.
+type SignResponse struct {
+	APIVersion string     `json:"apiVersion"`      // APIVersion is SignAPIVersion
+	Token      string     `json:"token,omitempty"` // Token is the RS256 signed JWT with the requested claims
+	Error      *SignError `json:"error,omitempty"` // Error reports why the JWT was not signed
+}
+
+// SignError is an error reported by an external signer.
+type SignError struct {
+	Code    string `json:"code,omitempty"` // Code is a machine readable error code, such as "unauthorized"
+	Message string `json:"message"`        // Message describes the error
+}
+
+func (e *SignError) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ExecError is returned when an ExecSigner's command fails to sign a JWT.
+type ExecError struct {
+	Command  string // Command is the command run
+	ExitCode int    // ExitCode is the command's exit code, or -1 if it did not exit, such as if it timed out
+	Stderr   string // Stderr is the command's standard error, truncated to 1 MiB
+	Err      error  // Err is the *SignError reported by the command, or the error running it
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("signer command %q failed", e.Command)
+	if e.ExitCode > 0 {
+		msg += fmt.Sprintf(" with exit code %d", e.ExitCode)
+	}
+	msg += ": " + e.Err.Error()
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Unwrap implements the standard library's error wrapping. It unwraps to the root cause.
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// ExecSigner signs JWT tokens by running an external command, allowing keys
+// to be held by HSMs or vaults accessed with tooling in any language.
+//
+// The command is passed a SignRequest as JSON on stdin, and must write a
+// SignResponse as JSON to stdout, for example:
+//
+//	stdin:  {"apiVersion":"ghinstallation/v1","claims":{"iss":"1","exp":1700000120,"iat":1700000000}}
+//	stdout: {"apiVersion":"ghinstallation/v1","token":"eyJhbGciOiJSUzI1NiIs..."}
+//
+// On failure, the command should write a SignResponse with Error set and exit
+// with a non-zero exit code. Anything written to stderr is included in the
+// returned *ExecError.
+//
+// JWTs are cached and reused for the same issuer until shortly before they
+// expire, so the command is not run for every request.
+//
+// ExecSigner is safe to be used concurrently.
+type ExecSigner struct {
+	Command string        // Command is the path or name of the executable to run
+	Args    []string      // Args are the command's arguments
+	Env     []string      // Env are additional environment variables, as "KEY=value", set for the command
+	Timeout time.Duration // Timeout limits how long the command may run, defaults to 10 seconds
+
+	mu        sync.Mutex // mu protects the cached JWT, and serializes running the command
+	token     string     // token is the cached JWT
+	issuer    string     // issuer is the cached JWT's iss claim
+	expiresAt time.Time  // expiresAt is the cached JWT's exp claim
+}
+
+var _ Signer = &ExecSigner{}
+
+// NewExecSigner returns an ExecSigner running command with args.
+func NewExecSigner(command string, args ...string) *ExecSigner {
+	return &ExecSigner{
+		Command: command,
+		Args:    args,
+		Timeout: defaultExecTimeout,
+	}
+}
+
+// Sign signs the JWT claims by running the command, or returns a cached JWT
+// for the same issuer that is not about to expire.
+func (s *ExecSigner) Sign(claims jwt.Claims) (string, error) {
+	js, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal claims: %w", err)
+	}
+	issuer := claimsIssuer(js)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.issuer == issuer && time.Now().Add(tokenReuseMargin).Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	token, err := s.run(js)
+	if err != nil {
+		return "", err
+	}
+	s.token, s.issuer, s.expiresAt = "", "", time.Time{}
+	if exp, ok := tokenExpiry(token); ok {
+		s.token, s.issuer, s.expiresAt = token, issuer, exp
+	}
+	return token, nil
+}
+
+// run runs the command to sign claims, returning the signed JWT.
+func (s *ExecSigner) run(claims []byte) (string, error) {
+	req, err := json.Marshal(SignRequest{APIVersion: SignAPIVersion, Claims: claims})
+	if err != nil {
+		return "", err
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	//nolint:gosec // G204: Command is controlled by library user
+	cmd := exec.CommandContext(ctx, s.Command, s.Args...)
+	cmd.Env = append(os.Environ(), s.Env...)
+	cmd.Stdin = bytes.NewReader(req)
+	stdout, stderr := &cappedBuffer{limit: maxExecOutput}, &cappedBuffer{limit: maxExecOutput}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = time.Second
+	runErr := cmd.Run()
+
+	execErr := &ExecError{
+		Command:  s.Command,
+		ExitCode: -1,
+		Stderr:   stderr.String(),
+	}
+	if cmd.ProcessState != nil {
+		execErr.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if ctx.Err() != nil {
+		execErr.Err = fmt.Errorf("timed out after %v: %w", timeout, ctx.Err())
+		return "", execErr
+	}
+
+	var resp SignResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		if runErr != nil {
+			execErr.Err = runErr
+		} else {
+			execErr.Err = fmt.Errorf("could not parse response: %w", err)
+		}
+		return "", execErr
+	}
+	switch {
+	case resp.Error != nil:
+		execErr.Err = resp.Error
+	case runErr != nil:
+		execErr.Err = runErr
+	case resp.Token == "":
+		execErr.Err = errors.New("response contains no token")
+	default:
+		return resp.Token, nil
+	}
+	return "", execErr
+}
+
+// claimsIssuer returns the iss claim of the JSON encoded claims, if any.
+func claimsIssuer(claims []byte) string {
+	var c struct {
+		Issuer string `json:"iss"`
+	}
+	_ = json.Unmarshal(claims, &c)
+	return c.Issuer
+}
+
+// tokenExpiry returns the exp claim of a JWT, without verifying its signature.
+func tokenExpiry(token string) (time.Time, bool) {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil || claims.ExpiresAt == nil {
+		return time.Time{}, false
+	}
+	return claims.ExpiresAt.Time, true
+}
+
+// cappedBuffer is a bytes.Buffer which discards writes beyond limit bytes.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.Len(); n < len(p) {
+		_, _ = b.Buffer.Write(p[:max(n, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,151 @@
+package ghinstallation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const execSignerHelperEnv = "GHINSTALLATION_EXEC_SIGNER_HELPER"
+
+// TestExecSignerHelperProcess is run as the ExecSigner's command by the other
+// tests, behaving according to the execSignerHelperEnv environment variable.
+func TestExecSignerHelperProcess(t *testing.T) {
+	mode := os.Getenv(execSignerHelperEnv)
+	if mode == "" {
+		return
+	}
+
+	if calls := os.Getenv("CALLS_FILE"); calls != "" {
+		f, err := os.OpenFile(calls, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err == nil {
+			fmt.Fprintln(f, "call")
+			f.Close()
+		}
+	}
+
+	var req SignRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintf(os.Stderr, "could not decode request: %v", err)
+		os.Exit(2)
+	}
+
+	switch mode {
+	case "sign":
+		key, _ := jwt.ParseRSAPrivateKeyFromPEM(key)
+		ss, err := NewRSASigner(jwt.SigningMethodRS256, key).Sign(jwt.MapClaims(claimsMap(req.Claims)))
+		if err != nil {
+			os.Exit(3)
+		}
+		_ = json.NewEncoder(os.Stdout).Encode(SignResponse{APIVersion: SignAPIVersion, Token: ss})
+	case "error":
+		fmt.Fprint(os.Stderr, "vault sealed")
+		_ = json.NewEncoder(os.Stdout).Encode(SignResponse{
+			APIVersion: SignAPIVersion,
+			Error:      &SignError{Code: "unavailable", Message: "could not reach vault"},
+		})
+		os.Exit(4)
+	case "sleep":
+		time.Sleep(10 * time.Second)
+	}
+	os.Exit(0)
+}
+
+func claimsMap(js json.RawMessage) map[string]interface{} {
+	m := make(map[string]interface{})
+	_ = json.Unmarshal(js, &m)
+	return m
+}
+
+func newHelperExecSigner(t *testing.T, mode string) *ExecSigner {
+	t.Helper()
+	s := NewExecSigner(os.Args[0], "-test.run=^TestExecSignerHelperProcess$")
+	s.Env = []string{execSignerHelperEnv + "=" + mode}
+	return s
+}
+
+func TestExecSigner(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := filepath.Join(t.TempDir(), "calls")
+	s := newHelperExecSigner(t, "sign")
+	s.Env = append(s.Env, "CALLS_FILE="+calls)
+
+	iat := time.Now().Truncate(time.Second)
+	claims := &jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(iat),
+		ExpiresAt: jwt.NewNumericDate(iat.Add(2 * time.Minute)),
+		Issuer:    "2",
+	}
+	ss, err := s.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	var got jwt.RegisteredClaims
+	if _, err := jwt.ParseWithClaims(ss, &got, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil }); err != nil {
+		t.Fatalf("could not verify JWT: %v", err)
+	}
+	if got.Issuer != "2" || !got.ExpiresAt.Equal(claims.ExpiresAt.Time) {
+		t.Errorf("claims got: %+v want: %+v", got, claims)
+	}
+
+	// The cached JWT is reused for the same issuer, but not another.
+	if cached, err := s.Sign(claims); err != nil || cached != ss {
+		t.Errorf("Sign got: %q, %v want cached JWT", cached, err)
+	}
+	other := *claims
+	other.Issuer = "3"
+	if _, err := s.Sign(&other); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "call"); n != 2 {
+		t.Errorf("command ran %d times want 2", n)
+	}
+}
+
+func TestExecSignerErrors(t *testing.T) {
+	claims := &jwt.RegisteredClaims{Issuer: "2"}
+
+	_, err := newHelperExecSigner(t, "error").Sign(claims)
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected ExecError, got: %v", err)
+	}
+	var signErr *SignError
+	if !errors.As(err, &signErr) || signErr.Code != "unavailable" {
+		t.Errorf("expected SignError with code unavailable, got: %v", err)
+	}
+	if execErr.ExitCode != 4 || execErr.Stderr != "vault sealed" {
+		t.Errorf("ExecError got exit code %d, stderr %q", execErr.ExitCode, execErr.Stderr)
+	}
+
+	s := newHelperExecSigner(t, "sleep")
+	s.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err = s.Sign(claims)
+	if !errors.As(err, &execErr) || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout ExecError, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+
+	_, err = NewExecSigner(filepath.Join(t.TempDir(), "missing")).Sign(claims)
+	if !errors.As(err, &execErr) {
+		t.Errorf("expected ExecError for missing command, got: %v", err)
+	}
+}
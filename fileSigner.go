@@ -0,0 +1,164 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// defaultReloadInterval is how often a FileSigner checks its key file for
+// changes.
+const defaultReloadInterval = 30 * time.Second
+
+// ReloadEvent reports an attempt to reload a FileSigner's private key after
+// the key file changed.
+type ReloadEvent struct {
+	Path string    // Path is the private key file
+	Time time.Time // Time is when the key was reloaded
+	Err  error     // Err is non-nil if the key was rejected, in which case the previous key remains in use
+}
+
+// FileSignerOption configures a FileSigner.
+type FileSignerOption func(*FileSigner)
+
+// WithReloadInterval configures how often the key file is checked for changes.
+// An interval of zero checks the file every time a JWT is signed.
+func WithReloadInterval(interval time.Duration) FileSignerOption {
+	return func(s *FileSigner) {
+		s.interval = interval
+	}
+}
+
+// WithReloadHandler configures a function to be called after each attempt to
+// reload the key.
+func WithReloadHandler(fn func(ReloadEvent)) FileSignerOption {
+	return func(s *FileSigner) {
+		s.onReload = fn
+	}
+}
+
+// WithPassphrase configures the passphrase used to decrypt the key.
+func WithPassphrase(passphrase []byte) FileSignerOption {
+	return func(s *FileSigner) {
+		s.passphrase = passphrase
+	}
+}
+
+// FileSigner signs JWT tokens using RS256 with a private key read from a file,
+// reloading the key when the file changes. This supports keys rotated in place,
+// such as those mounted from a secret manager.
+//
+// The file's modification time and size are checked at most once per reload
+// interval, when signing. If the changed file cannot be parsed, the previous
+// key remains in use.
+//
+// FileSigner is safe to be used concurrently.
+type FileSigner struct {
+	path       string
+	interval   time.Duration
+	onReload   func(ReloadEvent)
+	passphrase []byte
+
+	mu      sync.Mutex // mu protects the fields below
+	signer  *RSASigner // signer signs using the most recently loaded valid key
+	modTime time.Time  // modTime is the modification time of the file when last loaded
+	size    int64      // size is the size of the file when last loaded
+	checked time.Time  // checked is when the file was last checked for changes
+}
+
+var _ Signer = &FileSigner{}
+
+// NewFileSigner returns a FileSigner using the private key in path. The key is
+// parsed and if any errors occur the error is non-nil. See ParsePrivateKey for
+// the supported key formats.
+func NewFileSigner(path string, opts ...FileSignerOption) (*FileSigner, error) {
+	s := &FileSigner{
+		path:     path,
+		interval: defaultReloadInterval,
+	}
+	for _, fn := range opts {
+		fn(s)
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Sign signs the JWT claims with the most recently loaded key, first reloading
+// the key if the file changed.
+func (s *FileSigner) Sign(claims jwt.Claims) (string, error) {
+	s.mu.Lock()
+	var ev *ReloadEvent
+	if time.Since(s.checked) >= s.interval {
+		ev = s.reloadIfChanged()
+	}
+	signer := s.signer
+	s.mu.Unlock()
+
+	s.notify(ev)
+	return signer.Sign(claims)
+}
+
+// Reload reloads the key from the file, even if it has not changed. If the key
+// cannot be parsed, the error is non-nil and the previous key remains in use.
+func (s *FileSigner) Reload() error {
+	s.mu.Lock()
+	err := s.load()
+	s.mu.Unlock()
+
+	s.notify(&ReloadEvent{Path: s.path, Time: time.Now(), Err: err})
+	return err
+}
+
+// reloadIfChanged reloads the key if the file changed since it was last
+// loaded, returning the result or nil if the file did not change. s.mu must be
+// held.
+func (s *FileSigner) reloadIfChanged() *ReloadEvent {
+	s.checked = time.Now()
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return &ReloadEvent{Path: s.path, Time: s.checked, Err: fmt.Errorf("could not stat private key: %w", err)}
+	}
+	if fi.ModTime().Equal(s.modTime) && fi.Size() == s.size {
+		return nil
+	}
+	return &ReloadEvent{Path: s.path, Time: s.checked, Err: s.load()}
+}
+
+// load reads and parses the key, replacing the current key only if the new
+// key is valid. The file's modification time and size are recorded even if
+// the key is invalid, so that it is not reloaded until it changes again. s.mu
+// must be held, or s not yet shared.
+func (s *FileSigner) load() error {
+	// Stat before reading, so a change made while reading triggers a reload.
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("could not stat private key: %w", err)
+	}
+	s.modTime, s.size = fi.ModTime(), fi.Size()
+	s.checked = time.Now()
+
+	//nolint:gosec // G703: Path is controlled by library user
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("could not read private key: %w", err)
+	}
+	key, err := ParsePrivateKeyWithPassphrase(data, s.passphrase)
+	if err != nil {
+		return fmt.Errorf("could not parse private key: %w", err)
+	}
+	s.signer = NewRSASigner(jwt.SigningMethodRS256, key)
+	return nil
+}
+
+// notify calls the reload handler, if any, with ev.
+func (s *FileSigner) notify(ev *ReloadEvent) {
+	if ev != nil && s.onReload != nil {
+		s.onReload(*ev)
+	}
+}
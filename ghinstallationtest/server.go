@@ -0,0 +1,594 @@
+// Package ghinstallationtest provides a fake GitHub API server for testing
+// GitHub App authentication offline.
+//
+// The Server implements the endpoints used to authenticate as a GitHub App and
+// its installations, verifying app JWTs as GitHub does and issuing
+// installation access tokens. Requests authenticated with those tokens are
+// passed to the Server's Handler, allowing tests to fake the rest of the API.
+//
+//	srv := ghinstallationtest.NewServer()
+//	defer srv.Close()
+//	srv.AddApp(ghinstallationtest.App{ID: 1, Slug: "my-app", PublicKey: &key.PublicKey})
+//	srv.AddInstallation(ghinstallationtest.Installation{ID: 99, AppID: 1, Account: "my-org"})
+//
+//	itr := ghinstallation.NewFromAppsTransport(ghinstallation.NewAppsTransportFromPrivateKey(http.DefaultTransport, 1, key), 99)
+//	itr.BaseURL = srv.URL
+package ghinstallationtest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v88/github"
+)
+
+const (
+	// DefaultTokenTTL is the lifetime of installation access tokens issued by
+	// a Server, matching GitHub.
+	DefaultTokenTTL = time.Hour
+
+	// maxJWTLifetime is the longest lifetime of an app JWT accepted by GitHub.
+	maxJWTLifetime = 10 * time.Minute
+)
+
+// App is a GitHub App registered with a Server.
+type App struct {
+	ID        int64          // ID is the app's ID, the iss claim of its JWTs
+	Slug      string         // Slug is the app's URL-friendly name
+	Owner     string         // Owner is the login of the account owning the app
+	PublicKey *rsa.PublicKey // PublicKey verifies the app's JWTs
+}
+
+// Repository is a repository accessible to an Installation.
+type Repository struct {
+	ID   int64  // ID is the repository's ID
+	Name string // Name is the repository's name, without the owner
+}
+
+// Installation is an installation of a GitHub App registered with a Server.
+type Installation struct {
+	ID           int64                          // ID is the installation's ID
+	AppID        int64                          // AppID is the ID of the installed app
+	Account      string                         // Account is the login of the account the app is installed on
+	Permissions  github.InstallationPermissions // Permissions are the permissions granted to the installation
+	Repositories []Repository                   // Repositories are the repositories accessible to the installation
+	Suspended    bool                           // Suspended installations cannot create access tokens
+}
+
+// Token is an installation access token issued by a Server.
+type Token struct {
+	Token          string                         // Token is the access token
+	InstallationID int64                          // InstallationID is the installation the token was issued for
+	ExpiresAt      time.Time                      // ExpiresAt is when the token expires
+	Permissions    github.InstallationPermissions // Permissions are the token's permissions
+	Repositories   []Repository                   // Repositories are the repositories the token can access
+}
+
+// Failure is a failure injected into a Server's responses.
+type Failure struct {
+	Method string // Method is the method of requests to fail, or empty for any method
+	Path   string // Path is the path of requests to fail, such as "/app/installations/1/access_tokens"
+	Status int    // Status is the response status code
+	Body   string // Body is the response body, defaults to a JSON message
+	Count  int    // Count is the number of requests to fail, or zero to fail all matching requests
+}
+
+// Server is a fake GitHub API server. Its methods are safe to be used
+// concurrently.
+type Server struct {
+	*httptest.Server
+
+	// Handler, if set, handles requests authenticated with an installation
+	// access token issued by the server, other than those to endpoints
+	// implemented by the server. Use TokenFromRequest to identify the token.
+	// If nil, such requests receive 404 Not Found.
+	Handler http.Handler
+
+	// TokenTTL is the lifetime of issued installation access tokens, defaults
+	// to DefaultTokenTTL.
+	TokenTTL time.Duration
+
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+
+	mu            sync.Mutex
+	apps          map[int64]*App
+	installations map[int64]*Installation
+	tokens        map[string]*Token
+	failures      []*Failure
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when
+// finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		TokenTTL:      DefaultTokenTTL,
+		Now:           time.Now,
+		apps:          make(map[int64]*App),
+		installations: make(map[int64]*Installation),
+		tokens:        make(map[string]*Token),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /app", s.withApp(s.handleApp))
+	mux.HandleFunc("GET /app/installations", s.withApp(s.handleListInstallations))
+	mux.HandleFunc("GET /app/installations/{id}", s.withApp(s.handleGetInstallation))
+	mux.HandleFunc("POST /app/installations/{id}/access_tokens", s.withApp(s.handleCreateToken))
+	mux.HandleFunc("GET /installation/repositories", s.withToken(s.handleListRepositories))
+	mux.HandleFunc("DELETE /installation/token", s.withToken(s.handleRevokeToken))
+	mux.HandleFunc("/", s.withToken(s.handleAPI))
+
+	s.Server = httptest.NewServer(s.injectFailures(mux))
+	return s
+}
+
+// AddApp registers app, replacing any app with the same ID.
+func (s *Server) AddApp(app App) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apps[app.ID] = &app
+}
+
+// AddInstallation registers installation, replacing any installation with the
+// same ID.
+func (s *Server) AddInstallation(installation Installation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	installation.Repositories = append([]Repository(nil), installation.Repositories...)
+	s.installations[installation.ID] = &installation
+}
+
+// RemoveInstallation removes an installation and revokes its tokens, as if the
+// app was uninstalled.
+func (s *Server) RemoveInstallation(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.installations, id)
+	s.revokeInstallationTokens(id)
+}
+
+// SuspendInstallation suspends or unsuspends an installation. Suspending an
+// installation revokes its tokens.
+func (s *Server) SuspendInstallation(id int64, suspended bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if inst, ok := s.installations[id]; ok {
+		inst.Suspended = suspended
+	}
+	if suspended {
+		s.revokeInstallationTokens(id)
+	}
+}
+
+// Tokens returns the unexpired tokens issued for an installation, in order of
+// expiry.
+func (s *Server) Tokens(installationID int64) []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []Token
+	for _, tok := range s.tokens {
+		if tok.InstallationID == installationID && tok.ExpiresAt.After(s.Now()) {
+			tokens = append(tokens, *tok)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ExpiresAt.Before(tokens[j].ExpiresAt) })
+	return tokens
+}
+
+// RevokeToken revokes an installation access token.
+func (s *Server) RevokeToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+// InjectFailure causes requests matching f to fail. Failures are matched in the
+// order they were injected.
+func (s *Server) InjectFailure(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &f)
+}
+
+// TokenFromRequest returns the installation access token authenticating r, a
+// request passed to the Server's Handler.
+func TokenFromRequest(r *http.Request) (*Token, bool) {
+	tok, ok := r.Context().Value(tokenContextKey{}).(*Token)
+	return tok, ok
+}
+
+type tokenContextKey struct{}
+
+// revokeInstallationTokens revokes all tokens of an installation. s.mu must be
+// held.
+func (s *Server) revokeInstallationTokens(id int64) {
+	for k, tok := range s.tokens {
+		if tok.InstallationID == id {
+			delete(s.tokens, k)
+		}
+	}
+}
+
+// injectFailures responds with injected failures matching requests, otherwise
+// passing them to next.
+func (s *Server) injectFailures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f := s.matchFailure(r); f != nil {
+			body := f.Body
+			if body == "" {
+				body = fmt.Sprintf(`{"message":"injected failure: %d %s"}`, f.Status, http.StatusText(f.Status))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(f.Status)
+			fmt.Fprint(w, body)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// matchFailure returns a copy of the first failure matching r, if any,
+// consuming one of its count.
+func (s *Server) matchFailure(r *http.Request) *Failure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.failures {
+		if (f.Method != "" && f.Method != r.Method) || f.Path != r.URL.Path {
+			continue
+		}
+		match := *f
+		if f.Count > 0 {
+			if f.Count--; f.Count == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return &match
+	}
+	return nil
+}
+
+// withApp authenticates requests using an app JWT.
+func (s *Server) withApp(fn func(http.ResponseWriter, *http.Request, *App)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app, err := s.verifyJWT(r)
+		if err != nil {
+			writeMessage(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		fn(w, r, app)
+	}
+}
+
+// verifyJWT verifies the app JWT authenticating r, following GitHub's rules.
+func (s *Server) verifyJWT(r *http.Request) (*App, error) {
+	ss, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, apiError("A JSON web token could not be decoded")
+	}
+
+	var claims jwt.RegisteredClaims
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}), jwt.WithoutClaimsValidation())
+	var app *App
+	_, err := parser.ParseWithClaims(ss, &claims, func(*jwt.Token) (interface{}, error) {
+		id, err := strconv.ParseInt(claims.Issuer, 10, 64)
+		if err != nil {
+			return nil, apiError("'Issuer' claim ('iss') must be an Integer")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if app = s.apps[id]; app == nil {
+			return nil, apiError("Integration not found")
+		}
+		return app.PublicKey, nil
+	})
+	if err != nil {
+		var apiErr apiError
+		if errors.As(err, &apiErr) {
+			return nil, apiErr
+		}
+		return nil, apiError("A JSON web token could not be decoded")
+	}
+
+	now := s.Now()
+	switch {
+	case claims.IssuedAt == nil:
+		return nil, apiError("'Issued at' claim ('iat') must be an Integer representing the time that the assertion was issued")
+	case claims.ExpiresAt == nil:
+		return nil, apiError("'Expiration time' claim ('exp') must be a numeric value representing the future time at which the assertion expires")
+	case claims.IssuedAt.After(now):
+		return nil, apiError("'Issued at' claim ('iat') must be an Integer representing a time in the past")
+	case !claims.ExpiresAt.After(now):
+		return nil, apiError("'Expiration time' claim ('exp') must be a numeric value representing the future time at which the assertion expires")
+	case claims.ExpiresAt.Sub(claims.IssuedAt.Time) > maxJWTLifetime:
+		return nil, apiError("'Expiration time' claim ('exp') is too far in the future")
+	}
+	return app, nil
+}
+
+// withToken authenticates requests using an installation access token.
+func (s *Server) withToken(fn func(http.ResponseWriter, *http.Request, *Token)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		ss, ok := strings.CutPrefix(auth, "token ")
+		if !ok {
+			ss, _ = strings.CutPrefix(auth, "Bearer ")
+		}
+
+		s.mu.Lock()
+		tok, ok := s.tokens[ss]
+		if ok && !tok.ExpiresAt.After(s.Now()) {
+			delete(s.tokens, ss)
+			ok = false
+		}
+		s.mu.Unlock()
+		if !ok {
+			writeMessage(w, http.StatusUnauthorized, "Bad credentials")
+			return
+		}
+		fn(w, r, tok)
+	}
+}
+
+func (s *Server) handleApp(w http.ResponseWriter, _ *http.Request, app *App) {
+	writeJSON(w, http.StatusOK, &github.App{
+		ID:    github.Ptr(app.ID),
+		Slug:  github.Ptr(app.Slug),
+		Owner: &github.User{Login: github.Ptr(app.Owner)},
+	})
+}
+
+func (s *Server) handleListInstallations(w http.ResponseWriter, _ *http.Request, app *App) {
+	s.mu.Lock()
+	installations := make([]*github.Installation, 0)
+	for _, inst := range s.installations {
+		if inst.AppID == app.ID {
+			installations = append(installations, inst.toGitHub(s.Now()))
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(installations, func(i, j int) bool { return installations[i].GetID() < installations[j].GetID() })
+	writeJSON(w, http.StatusOK, installations)
+}
+
+func (s *Server) handleGetInstallation(w http.ResponseWriter, r *http.Request, app *App) {
+	inst, ok := s.installation(r, app)
+	if !ok {
+		writeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, inst.toGitHub(s.Now()))
+}
+
+func (s *Server) handleCreateToken(w http.ResponseWriter, r *http.Request, app *App) {
+	inst, ok := s.installation(r, app)
+	if !ok {
+		writeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if inst.Suspended {
+		writeMessage(w, http.StatusForbidden, "This installation has been suspended")
+		return
+	}
+
+	var opts github.InstallationTokenOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			writeMessage(w, http.StatusBadRequest, "Problems parsing JSON")
+			return
+		}
+	}
+
+	tok := &Token{
+		InstallationID: inst.ID,
+		ExpiresAt:      s.Now().Add(s.TokenTTL).Truncate(time.Second),
+		Permissions:    inst.Permissions,
+		Repositories:   inst.Repositories,
+	}
+	if opts.Permissions != nil {
+		if err := checkPermissions(opts.Permissions, &inst.Permissions); err != nil {
+			writeMessage(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		tok.Permissions = *opts.Permissions
+	}
+	if len(opts.Repositories) > 0 || len(opts.RepositoryIDs) > 0 {
+		repos, err := selectRepositories(inst.Repositories, opts.Repositories, opts.RepositoryIDs)
+		if err != nil {
+			writeMessage(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		tok.Repositories = repos
+	}
+	tok.Token = newToken()
+
+	s.mu.Lock()
+	s.tokens[tok.Token] = tok
+	s.mu.Unlock()
+
+	resp := &github.InstallationToken{
+		Token:       github.Ptr(tok.Token),
+		ExpiresAt:   &github.Timestamp{Time: tok.ExpiresAt},
+		Permissions: &tok.Permissions,
+	}
+	if len(opts.Repositories) > 0 || len(opts.RepositoryIDs) > 0 {
+		resp.Repositories = toGitHubRepositories(inst.Account, tok.Repositories)
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleListRepositories(w http.ResponseWriter, _ *http.Request, tok *Token) {
+	s.mu.Lock()
+	account := ""
+	if inst, ok := s.installations[tok.InstallationID]; ok {
+		account = inst.Account
+	}
+	s.mu.Unlock()
+	repos := toGitHubRepositories(account, tok.Repositories)
+	writeJSON(w, http.StatusOK, &github.ListRepositories{
+		TotalCount:   github.Ptr(len(repos)),
+		Repositories: repos,
+	})
+}
+
+func (s *Server) handleRevokeToken(w http.ResponseWriter, _ *http.Request, tok *Token) {
+	s.RevokeToken(tok.Token)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request, tok *Token) {
+	if s.Handler == nil {
+		writeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.Handler.ServeHTTP(w, r.WithContext(contextWithToken(r, tok)))
+}
+
+// installation returns the installation of app identified by the request's id
+// path value.
+func (s *Server) installation(r *http.Request, app *App) (Installation, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return Installation{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.installations[id]
+	if !ok || inst.AppID != app.ID {
+		return Installation{}, false
+	}
+	return *inst, true
+}
+
+// toGitHub returns the installation as returned by the API at now.
+func (inst *Installation) toGitHub(now time.Time) *github.Installation {
+	gi := &github.Installation{
+		ID:          github.Ptr(inst.ID),
+		AppID:       github.Ptr(inst.AppID),
+		Account:     &github.User{Login: github.Ptr(inst.Account)},
+		Permissions: &inst.Permissions,
+	}
+	if inst.Suspended {
+		gi.SuspendedAt = &github.Timestamp{Time: now}
+	}
+	return gi
+}
+
+// apiError is an error whose message is returned by the API, matching GitHub's
+// messages.
+type apiError string
+
+func (e apiError) Error() string { return string(e) }
+
+const errRepositoryNotAccessible = apiError("There is at least one repository that does not exist or is not accessible to the parent installation.")
+
+// levels orders permission levels.
+var levels = map[string]int{"read": 1, "write": 2, "admin": 3}
+
+// checkPermissions returns an error if requested includes permissions not
+// granted.
+func checkPermissions(requested, granted *github.InstallationPermissions) error {
+	req, err := permissionMap(requested)
+	if err != nil {
+		return err
+	}
+	grant, err := permissionMap(granted)
+	if err != nil {
+		return err
+	}
+	for name, level := range req {
+		if levels[level] == 0 || levels[level] > levels[grant[name]] {
+			return apiError("The permissions requested are not granted to this installation.")
+		}
+	}
+	return nil
+}
+
+// permissionMap returns permissions as a map of permission names to levels.
+func permissionMap(permissions *github.InstallationPermissions) (map[string]string, error) {
+	js, err := json.Marshal(permissions)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	return m, json.Unmarshal(js, &m)
+}
+
+// selectRepositories returns the repositories of available identified by names
+// or ids, or an error if any are not available.
+func selectRepositories(available []Repository, names []string, ids []int64) ([]Repository, error) {
+	var selected []Repository
+	for _, name := range names {
+		repo, ok := findRepository(available, func(r Repository) bool { return strings.EqualFold(r.Name, name) })
+		if !ok {
+			return nil, errRepositoryNotAccessible
+		}
+		selected = append(selected, repo)
+	}
+	for _, id := range ids {
+		repo, ok := findRepository(available, func(r Repository) bool { return r.ID == id })
+		if !ok {
+			return nil, errRepositoryNotAccessible
+		}
+		selected = append(selected, repo)
+	}
+	return selected, nil
+}
+
+func findRepository(repos []Repository, match func(Repository) bool) (Repository, bool) {
+	for _, r := range repos {
+		if match(r) {
+			return r, true
+		}
+	}
+	return Repository{}, false
+}
+
+func toGitHubRepositories(owner string, repos []Repository) []*github.Repository {
+	out := make([]*github.Repository, 0, len(repos))
+	for _, r := range repos {
+		out = append(out, &github.Repository{
+			ID:       github.Ptr(r.ID),
+			Name:     github.Ptr(r.Name),
+			FullName: github.Ptr(owner + "/" + r.Name),
+			Owner:    &github.User{Login: github.Ptr(owner)},
+		})
+	}
+	return out
+}
+
+// newToken returns a random installation access token.
+func newToken() string {
+	b := make([]byte, 18)
+	_, _ = rand.Read(b)
+	return "ghs_" + hex.EncodeToString(b)
+}
+
+func contextWithToken(r *http.Request, tok *Token) context.Context {
+	return context.WithValue(r.Context(), tokenContextKey{}, tok)
+}
+
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
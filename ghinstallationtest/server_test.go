@@ -0,0 +1,284 @@
+package ghinstallationtest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v88/github"
+)
+
+const (
+	appID          = 1
+	installationID = 99
+)
+
+var (
+	keyOnce sync.Once
+	testKey *rsa.PrivateKey
+)
+
+func privateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	keyOnce.Do(func() {
+		var err error
+		if testKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return testKey
+}
+
+func newServer(t *testing.T) *Server {
+	t.Helper()
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddApp(App{ID: appID, Slug: "test-app", Owner: "octo-org", PublicKey: &privateKey(t).PublicKey})
+	srv.AddInstallation(Installation{
+		ID:      installationID,
+		AppID:   appID,
+		Account: "octo-org",
+		Permissions: github.InstallationPermissions{
+			Contents: github.Ptr("write"),
+			Issues:   github.Ptr("read"),
+		},
+		Repositories: []Repository{{ID: 10, Name: "hello-world"}, {ID: 11, Name: "spoon-knife"}},
+	})
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok, _ := TokenFromRequest(r)
+		_, _ = io.WriteString(w, strconv.FormatInt(tok.InstallationID, 10))
+	})
+	return srv
+}
+
+func newTransport(t *testing.T, srv *Server) *ghinstallation.Transport {
+	t.Helper()
+	atr := ghinstallation.NewAppsTransportFromPrivateKey(http.DefaultTransport, appID, privateKey(t))
+	atr.BaseURL = srv.URL
+	itr := ghinstallation.NewFromAppsTransport(atr, installationID)
+	itr.BaseURL = srv.URL
+	return itr
+}
+
+func TestServer(t *testing.T) {
+	srv := newServer(t)
+	srv.TokenTTL = 30 * time.Minute
+	itr := newTransport(t, srv)
+
+	client := &http.Client{Transport: itr}
+	resp, err := client.Get(srv.URL + "/repos/octo-org/hello-world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "99" {
+		t.Errorf("response got: %d %q want: 200 %q", resp.StatusCode, body, "99")
+	}
+
+	expiresAt, _, err := itr.Expiry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d > 30*time.Minute || d < 29*time.Minute {
+		t.Errorf("token expires in %v want 30m", d)
+	}
+	perms, err := itr.Permissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perms.GetContents() != "write" || perms.GetIssues() != "read" {
+		t.Errorf("permissions got: %+v", perms)
+	}
+	if tokens := srv.Tokens(installationID); len(tokens) != 1 {
+		t.Errorf("issued %d tokens want 1", len(tokens))
+	}
+}
+
+func TestServerTokenOptions(t *testing.T) {
+	srv := newServer(t)
+
+	itr := newTransport(t, srv)
+	itr.InstallationTokenOptions = &github.InstallationTokenOptions{
+		RepositoryIDs: []int64{11},
+		Permissions:   &github.InstallationPermissions{Contents: github.Ptr("read")},
+	}
+	if _, err := itr.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	repos, err := itr.Repositories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].GetFullName() != "octo-org/spoon-knife" {
+		t.Errorf("repositories got: %v", repos)
+	}
+	if perms, _ := itr.Permissions(); perms.GetContents() != "read" || perms.Issues != nil {
+		t.Errorf("permissions got: %+v", perms)
+	}
+
+	for _, opts := range []*github.InstallationTokenOptions{
+		{Permissions: &github.InstallationPermissions{Issues: github.Ptr("write")}},
+		{Permissions: &github.InstallationPermissions{Administration: github.Ptr("read")}},
+		{Repositories: []string{"not-installed"}},
+	} {
+		itr := newTransport(t, srv)
+		itr.InstallationTokenOptions = opts
+		_, err := itr.Token(context.Background())
+		var httpErr *ghinstallation.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Response.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("options %+v: expected 422 HTTPError, got: %v", opts, err)
+		}
+	}
+}
+
+func TestServerRevocation(t *testing.T) {
+	srv := newServer(t)
+	itr := newTransport(t, srv)
+	token, err := itr.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Header.Set("Authorization", "token "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := do(http.MethodDelete, "/installation/token"); got != http.StatusNoContent {
+		t.Errorf("revoke status got: %d want: %d", got, http.StatusNoContent)
+	}
+	if got := do(http.MethodGet, "/installation/repositories"); got != http.StatusUnauthorized {
+		t.Errorf("status after revocation got: %d want: %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestServerInstallations(t *testing.T) {
+	srv := newServer(t)
+	srv.AddInstallation(Installation{ID: 100, AppID: appID, Account: "other-org"})
+	srv.AddInstallation(Installation{ID: 200, AppID: 2, Account: "other-app"})
+
+	atr := ghinstallation.NewAppsTransportFromPrivateKey(http.DefaultTransport, appID, privateKey(t))
+	atr.BaseURL = srv.URL
+	client, err := github.NewClient(github.WithTransport(atr), github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installations, _, err := client.Apps.ListInstallations(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installations) != 2 || installations[0].GetID() != installationID || installations[1].GetID() != 100 {
+		t.Errorf("installations got: %v", installations)
+	}
+	if _, _, err := client.Apps.GetInstallation(context.Background(), 200); err == nil {
+		t.Error("expected error getting another app's installation")
+	}
+
+	if _, err := atr.Verify(context.Background(), ghinstallation.AppIdentity{Slug: "test-app", Owner: "octo-org"}); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	srv.SuspendInstallation(100, true)
+	_, err = ghinstallation.NewFromAppsTransport(atr, 100).Token(context.Background())
+	var httpErr *ghinstallation.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Response.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 HTTPError for suspended installation, got: %v", err)
+	}
+}
+
+func TestServerJWT(t *testing.T) {
+	srv := newServer(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	for _, tc := range []struct {
+		name   string
+		key    *rsa.PrivateKey
+		claims jwt.RegisteredClaims
+	}{
+		{name: "wrong key", key: other, claims: jwt.RegisteredClaims{Issuer: "1", IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))}},
+		{name: "unknown app", key: privateKey(t), claims: jwt.RegisteredClaims{Issuer: "3", IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))}},
+		{name: "missing iat", key: privateKey(t), claims: jwt.RegisteredClaims{Issuer: "1", ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))}},
+		{name: "future iat", key: privateKey(t), claims: jwt.RegisteredClaims{Issuer: "1", IssuedAt: jwt.NewNumericDate(now.Add(time.Minute)), ExpiresAt: jwt.NewNumericDate(now.Add(2 * time.Minute))}},
+		{name: "expired", key: privateKey(t), claims: jwt.RegisteredClaims{Issuer: "1", IssuedAt: jwt.NewNumericDate(now.Add(-5 * time.Minute)), ExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute))}},
+		{name: "lifetime", key: privateKey(t), claims: jwt.RegisteredClaims{Issuer: "1", IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(11 * time.Minute))}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ss, err := jwt.NewWithClaims(jwt.SigningMethodRS256, tc.claims).SignedString(tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/app/installations/99/access_tokens", nil)
+			req.Header.Set("Authorization", "Bearer "+ss)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("status got: %d want: %d", resp.StatusCode, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestServerInjectFailure(t *testing.T) {
+	srv := newServer(t)
+	srv.InjectFailure(Failure{
+		Method: http.MethodPost,
+		Path:   "/app/installations/99/access_tokens",
+		Status: http.StatusServiceUnavailable,
+		Count:  1,
+	})
+
+	itr := newTransport(t, srv)
+	_, err := itr.Token(context.Background())
+	var httpErr *ghinstallation.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 HTTPError, got: %v", err)
+	}
+	if _, err := itr.Token(context.Background()); err != nil {
+		t.Errorf("expected failure to be consumed, got: %v", err)
+	}
+}
+
+func TestServerTokenExpiry(t *testing.T) {
+	srv := newServer(t)
+	itr := newTransport(t, srv)
+	token, err := itr.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/installation/repositories", nil)
+	req.Header.Set("Authorization", "token "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status got: %d want: %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
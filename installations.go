@@ -0,0 +1,72 @@
+package ghinstallation
+
+import "sync"
+
+// Installations caches a Transport for each installation of a GitHub App,
+// created from a shared AppsTransport, so installation tokens are reused
+// across requests for the same installation. This is useful for services
+// acting on behalf of many installations, such as webhook receivers.
+//
+// Installations is safe to be used concurrently.
+type Installations struct {
+	// Configure, if set, is called with each Transport when it is created,
+	// such as to set ScopeToRepository or InstallationTokenOptions.
+	Configure func(*Transport)
+
+	atr        *AppsTransport
+	mu         sync.Mutex
+	transports map[int64]*Transport
+}
+
+// NewInstallations returns an Installations creating Transports from atr.
+func NewInstallations(atr *AppsTransport) *Installations {
+	return &Installations{
+		atr:        atr,
+		transports: make(map[int64]*Transport),
+	}
+}
+
+// AppsTransport returns the AppsTransport used to create Transports.
+func (i *Installations) AppsTransport() *AppsTransport {
+	return i.atr
+}
+
+// Transport returns the cached Transport for installationID, creating it if
+// necessary.
+func (i *Installations) Transport(installationID int64) *Transport {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if t, ok := i.transports[installationID]; ok {
+		return t
+	}
+	t := NewFromAppsTransport(i.atr, installationID)
+	if i.Configure != nil {
+		i.Configure(t)
+	}
+	i.transports[installationID] = t
+	return t
+}
+
+// Forget removes the cached Transport for installationID and discards its
+// tokens, such as when the app is uninstalled. A new Transport, with a new
+// token, is created the next time Transport is called.
+func (i *Installations) Forget(installationID int64) {
+	i.mu.Lock()
+	t, ok := i.transports[installationID]
+	delete(i.transports, installationID)
+	i.mu.Unlock()
+	if ok {
+		t.Invalidate()
+	}
+}
+
+// Invalidate discards the tokens of the cached Transport for installationID,
+// if any, such as when the installation's permissions or repositories change.
+func (i *Installations) Invalidate(installationID int64) {
+	i.mu.Lock()
+	t, ok := i.transports[installationID]
+	i.mu.Unlock()
+	if ok {
+		t.Invalidate()
+	}
+}
@@ -0,0 +1,90 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInstallations(t *testing.T) {
+	atr, err := NewAppsTransport(http.DefaultTransport, appID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atr.BaseURL = "https://github.example.com/api/v3"
+	installations := NewInstallations(atr)
+	installations.Configure = func(tr *Transport) { tr.ScopeToRepository = true }
+
+	tr := installations.Transport(installationID)
+	if tr.InstallationID() != installationID || tr.BaseURL != atr.BaseURL || !tr.ScopeToRepository {
+		t.Errorf("Transport got installation %d, base URL %q, ScopeToRepository %v", tr.InstallationID(), tr.BaseURL, tr.ScopeToRepository)
+	}
+	if installations.Transport(installationID) != tr {
+		t.Error("Transport did not return the cached Transport")
+	}
+	if installations.Transport(installationID+1) == tr {
+		t.Error("Transport returned the same Transport for another installation")
+	}
+
+	tr.token = &accessToken{Token: "abc", ExpiresAt: time.Now().Add(time.Hour)}
+	tr.repoTokens = map[string]*accessToken{"owner/repo": {Token: "def"}}
+	installations.Invalidate(installationID)
+	if tr.token != nil || tr.repoTokens != nil {
+		t.Error("Invalidate did not discard the Transport's tokens")
+	}
+
+	tr.token = &accessToken{Token: "abc", ExpiresAt: time.Now().Add(time.Hour)}
+	installations.Forget(installationID)
+	if installations.Transport(installationID) == tr {
+		t.Error("Transport returned the forgotten Transport")
+	}
+	if tr.token != nil {
+		t.Error("Forget did not discard the Transport's tokens")
+	}
+}
+
+func TestInstallationsConcurrent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/app/installations/"), "/access_tokens")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		js, _ := json.Marshal(accessToken{
+			Token:     "token-" + id,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		fmt.Fprintln(w, string(js))
+	}))
+	defer ts.Close()
+
+	atr, err := NewAppsTransport(http.DefaultTransport, appID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atr.BaseURL = ts.URL
+	installations := NewInstallations(atr)
+
+	var wg sync.WaitGroup
+	for id := int64(1); id <= 8; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := installations.Transport(id).Token(context.Background())
+			if err != nil {
+				t.Errorf("Token for installation %d: %v", id, err)
+				return
+			}
+			if want := fmt.Sprintf("token-%d", id); token != want {
+				t.Errorf("Token for installation %d got %q want %q", id, token, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
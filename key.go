@@ -0,0 +1,328 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des" //nolint:gosec // G502: 3DES is supported to decrypt existing keys only
+	"crypto/pbkdf2"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // G505: HMAC-SHA1 is the PBKDF2 default PRF
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Private key formats reported by PrivateKeyError.
+const (
+	formatPKCS1PEM          = "PKCS #1 PEM"
+	formatEncryptedPKCS1PEM = "encrypted PKCS #1 PEM"
+	formatPKCS8PEM          = "PKCS #8 PEM"
+	formatEncryptedPKCS8PEM = "encrypted PKCS #8 PEM"
+	formatEncryptedPKCS8DER = "encrypted PKCS #8 DER"
+	formatECPEM             = "EC PEM"
+	formatOpenSSHPEM        = "OpenSSH PEM"
+	formatPEM               = "PEM"
+	formatDER               = "DER"
+	formatBase64            = "base64"
+)
+
+// maxPBKDF2Iterations limits the PBKDF2 iteration count of encrypted keys, so
+// malformed keys cannot make parsing run for an unbounded time.
+const maxPBKDF2Iterations = 10_000_000
+
+// ErrPassphraseRequired is returned when parsing an encrypted private key
+// without a passphrase.
+var ErrPassphraseRequired = errors.New("key is encrypted and requires a passphrase")
+
+// ErrIncorrectPassphrase is returned when an encrypted private key cannot be
+// decrypted with the given passphrase.
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// PrivateKeyError is returned when a private key cannot be parsed. It reports
+// the format detected and why the key was rejected.
+type PrivateKeyError struct {
+	Format string // Format is the detected format of the key, such as "PKCS #8 PEM"
+	Err    error  // Err is the reason the key was rejected
+}
+
+func (e *PrivateKeyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Format, e.Err)
+}
+
+// Unwrap implements the standard library's error wrapping. It unwraps to the reason the key was rejected.
+func (e *PrivateKeyError) Unwrap() error {
+	return e.Err
+}
+
+// ParsePrivateKey parses an RSA private key in any of the following formats:
+//
+//   - PKCS #1 or PKCS #8 PEM, such as the keys generated by GitHub
+//   - PKCS #1 or PKCS #8 DER
+//   - Base64 encoded PEM or DER, as often stored in environment variables
+//   - PEM bundles, where the first private key block is used and other blocks,
+//     such as certificates, are ignored
+//
+// Encrypted keys require ParsePrivateKeyWithPassphrase. If the key cannot be
+// parsed, a *PrivateKeyError is returned.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	return ParsePrivateKeyWithPassphrase(data, nil)
+}
+
+// ParsePrivateKeyWithPassphrase is like ParsePrivateKey, but also supports keys
+// encrypted with passphrase, either as legacy encrypted PKCS #1 PEM or as
+// PKCS #8 using PBES2 with AES or 3DES.
+func ParsePrivateKeyWithPassphrase(data, passphrase []byte) (*rsa.PrivateKey, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0:
+		return nil, errors.New("private key is empty")
+	case bytes.Contains(data, []byte("-----BEGIN")):
+		return parsePEM(data, passphrase)
+	case data[0] == 0x30: // ASN.1 SEQUENCE
+		return parseDER(formatDER, data, passphrase)
+	}
+
+	decoded, err := decodeBase64(data)
+	if err != nil {
+		return nil, &PrivateKeyError{Format: formatBase64, Err: fmt.Errorf("key is not PEM or DER, and could not be decoded as base64: %w", err)}
+	}
+	if bytes.Contains(decoded, []byte("-----BEGIN")) {
+		return parsePEM(bytes.TrimSpace(decoded), passphrase)
+	}
+	return parseDER(formatBase64+" "+formatDER, decoded, passphrase)
+}
+
+// decodeBase64 decodes standard or URL base64 encoded data, with or without
+// padding and ignoring whitespace.
+func decodeBase64(data []byte) ([]byte, error) {
+	s := strings.Join(strings.Fields(string(data)), "")
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		var decoded []byte
+		if decoded, err = enc.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, err
+}
+
+// parsePEM parses the first private key block in data, ignoring other blocks.
+func parsePEM(data, passphrase []byte) (*rsa.PrivateKey, error) {
+	var skipped []string
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return parsePKCS1PEM(block, passphrase)
+		case "PRIVATE KEY":
+			return parsePKCS8(formatPKCS8PEM, block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			return parseEncryptedPKCS8(formatEncryptedPKCS8PEM, block.Bytes, passphrase)
+		case "EC PRIVATE KEY":
+			return nil, &PrivateKeyError{Format: formatECPEM, Err: errors.New("EC keys are not supported, GitHub Apps require RSA keys")}
+		case "OPENSSH PRIVATE KEY":
+			return nil, &PrivateKeyError{Format: formatOpenSSHPEM, Err: errors.New("OpenSSH keys are not supported, use the PEM file generated by GitHub")}
+		}
+		skipped = append(skipped, block.Type)
+	}
+	if len(skipped) == 0 {
+		return nil, &PrivateKeyError{Format: formatPEM, Err: errors.New("no valid PEM block found")}
+	}
+	return nil, &PrivateKeyError{Format: formatPEM, Err: fmt.Errorf("no private key block found, only %s", strings.Join(skipped, ", "))}
+}
+
+// parsePKCS1PEM parses a PKCS #1 PEM block, which may be encrypted.
+func parsePKCS1PEM(block *pem.Block, passphrase []byte) (*rsa.PrivateKey, error) {
+	if !strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, &PrivateKeyError{Format: formatPKCS1PEM, Err: err}
+		}
+		return key, nil
+	}
+
+	if len(passphrase) == 0 {
+		return nil, &PrivateKeyError{Format: formatEncryptedPKCS1PEM, Err: ErrPassphraseRequired}
+	}
+	//nolint:staticcheck // SA1019: legacy PEM encryption is insecure, but still produced by openssl
+	der, err := x509.DecryptPEMBlock(block, passphrase)
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, &PrivateKeyError{Format: formatEncryptedPKCS1PEM, Err: ErrIncorrectPassphrase}
+	}
+	if err != nil {
+		return nil, &PrivateKeyError{Format: formatEncryptedPKCS1PEM, Err: err}
+	}
+	key, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		// As with PKCS #8, an incorrect passphrase may leave valid padding.
+		return nil, &PrivateKeyError{Format: formatEncryptedPKCS1PEM, Err: ErrIncorrectPassphrase}
+	}
+	return key, nil
+}
+
+// parseDER parses a PKCS #1, PKCS #8 or encrypted PKCS #8 DER key.
+func parseDER(format string, der, passphrase []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return parsePKCS8(format, der)
+	}
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err == nil && len(rest) == 0 {
+		return parseEncryptedPKCS8(formatEncryptedPKCS8DER, der, passphrase)
+	}
+	return nil, &PrivateKeyError{Format: format, Err: errors.New("not a PKCS #1 or PKCS #8 private key")}
+}
+
+// parsePKCS8 parses a PKCS #8 key, which must be an RSA key.
+func parsePKCS8(format string, der []byte) (*rsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, &PrivateKeyError{Format: format, Err: err}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, &PrivateKeyError{Format: format, Err: fmt.Errorf("key type %T is not supported, GitHub Apps require RSA keys", key)}
+	}
+	return rsaKey, nil
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// encryptedPrivateKeyInfo is an encrypted PKCS #8 key, see RFC 5958 section 3.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the parameters of the PBES2 encryption scheme, see RFC 8018
+// appendix A.4.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the parameters of the PBKDF2 key derivation function, see
+// RFC 8018 appendix A.2.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// parseEncryptedPKCS8 decrypts and parses an encrypted PKCS #8 key.
+func parseEncryptedPKCS8(format string, der, passphrase []byte) (*rsa.PrivateKey, error) {
+	if len(passphrase) == 0 {
+		return nil, &PrivateKeyError{Format: format, Err: ErrPassphraseRequired}
+	}
+	plain, err := decryptPKCS8(der, passphrase)
+	if err != nil {
+		return nil, &PrivateKeyError{Format: format, Err: err}
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(plain); err != nil {
+		// Decryption with the wrong passphrase succeeds only if the padding
+		// happens to be valid, leaving garbage which cannot be parsed.
+		return nil, &PrivateKeyError{Format: format, Err: ErrIncorrectPassphrase}
+	}
+	return parsePKCS8(format, plain)
+}
+
+// decryptPKCS8 decrypts a PKCS #8 key encrypted using PBES2.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("could not parse encrypted key: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption algorithm %v, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("could not parse PBES2 parameters: %w", err)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %v, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("could not parse PBKDF2 parameters: %w", err)
+	}
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("invalid PBKDF2 iteration count %d, expected at most %d", kdf.IterationCount, maxPBKDF2Iterations)
+	}
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %v", kdf.PRF.Algorithm)
+	}
+
+	var (
+		keyLen    int
+		newCipher func([]byte) (cipher.Block, error)
+	)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported encryption scheme %v", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("could not parse encryption scheme IV: %w", err)
+	}
+
+	dk, err := pbkdf2.Key(prf, string(passphrase), kdf.Salt, kdf.IterationCount, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive key: %w", err)
+	}
+	block, err := newCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted key length or IV")
+	}
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	// Remove PKCS #7 padding, which is invalid if the passphrase is incorrect.
+	n := int(plain[len(plain)-1])
+	if n == 0 || n > block.BlockSize() || !bytes.Equal(plain[len(plain)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return plain[:len(plain)-n], nil
+}
@@ -0,0 +1,211 @@
+package ghinstallation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const passphrase = "hunter2"
+
+func TestParsePrivateKey(t *testing.T) {
+	want, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := x509.MarshalPKCS1PrivateKey(want)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a certificate")})
+
+	for _, tc := range []struct {
+		name       string
+		data       []byte
+		passphrase string
+	}{
+		{name: "PKCS #1 PEM", data: key},
+		{name: "PKCS #8 PEM", data: pkcs8PEM},
+		{name: "PKCS #1 DER", data: pkcs1},
+		{name: "PKCS #8 DER", data: pkcs8},
+		{name: "base64 PEM", data: []byte(base64.StdEncoding.EncodeToString(key))},
+		{name: "base64 DER", data: []byte(base64.RawURLEncoding.EncodeToString(pkcs8))},
+		{name: "bundle", data: append(append(cert, '\n'), pkcs8PEM...)},
+		{name: "whitespace", data: append(append([]byte("\n  "), key...), "\n\n"...)},
+		{name: "encrypted PKCS #1 PEM", data: readTestdata(t, "pkcs1-aes128.pem"), passphrase: passphrase},
+		{name: "encrypted PKCS #8 PEM AES", data: readTestdata(t, "pkcs8-aes256.pem"), passphrase: passphrase},
+		{name: "encrypted PKCS #8 PEM 3DES", data: readTestdata(t, "pkcs8-des3.pem"), passphrase: passphrase},
+		{name: "encrypted PKCS #8 DER", data: pemBytes(t, readTestdata(t, "pkcs8-aes256.pem")), passphrase: passphrase},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParsePrivateKeyWithPassphrase(tc.data, []byte(tc.passphrase))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(want) {
+				t.Error("parsed key does not match")
+			}
+		})
+	}
+}
+
+func TestParsePrivateKeyErrors(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A key whose PBKDF2 iteration count would take effectively forever.
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(pemBytes(t, readTestdata(t, "pkcs8-aes256.pem")), &info); err != nil {
+		t.Fatal(err)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		t.Fatal(err)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatal(err)
+	}
+	kdf.IterationCount = 1 << 40
+	if params.KeyDerivationFunc.Parameters.FullBytes, err = asn1.Marshal(kdf); err != nil {
+		t.Fatal(err)
+	}
+	if info.Algorithm.Parameters.FullBytes, err = asn1.Marshal(params); err != nil {
+		t.Fatal(err)
+	}
+	slowDER, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		data       []byte
+		passphrase string
+		format     string
+		err        error
+		contains   string
+	}{
+		{
+			name:     "EC PKCS #8",
+			data:     pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecPKCS8}),
+			format:   "PKCS #8 PEM",
+			contains: "*ecdsa.PrivateKey is not supported",
+		},
+		{
+			name:     "EC PEM",
+			data:     pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}),
+			format:   "EC PEM",
+			contains: "GitHub Apps require RSA keys",
+		},
+		{
+			name:     "certificate only",
+			data:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("cert")}),
+			format:   "PEM",
+			contains: "only CERTIFICATE",
+		},
+		{
+			name:   "encrypted PKCS #8 without passphrase",
+			data:   readTestdata(t, "pkcs8-aes256.pem"),
+			format: "encrypted PKCS #8 PEM",
+			err:    ErrPassphraseRequired,
+		},
+		{
+			name:       "encrypted PKCS #8 incorrect passphrase",
+			data:       readTestdata(t, "pkcs8-aes256.pem"),
+			passphrase: "wrong",
+			format:     "encrypted PKCS #8 PEM",
+			err:        ErrIncorrectPassphrase,
+		},
+		{
+			name:       "encrypted PKCS #8 excessive iterations",
+			data:       pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: slowDER}),
+			passphrase: "test",
+			format:     "encrypted PKCS #8 PEM",
+			contains:   "invalid PBKDF2 iteration count",
+		},
+		{
+			name:   "encrypted PKCS #1 without passphrase",
+			data:   readTestdata(t, "pkcs1-aes128.pem"),
+			format: "encrypted PKCS #1 PEM",
+			err:    ErrPassphraseRequired,
+		},
+		{
+			name:       "encrypted PKCS #1 incorrect passphrase",
+			data:       readTestdata(t, "pkcs1-aes128.pem"),
+			passphrase: "wrong",
+			format:     "encrypted PKCS #1 PEM",
+			err:        ErrIncorrectPassphrase,
+		},
+		{
+			name:     "DER garbage",
+			data:     []byte{0x30, 0x03, 0x02, 0x01, 0x00},
+			format:   "DER",
+			contains: "not a PKCS #1 or PKCS #8 private key",
+		},
+		{
+			name:     "not base64",
+			data:     []byte("not a key!"),
+			format:   "base64",
+			contains: "could not be decoded as base64",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParsePrivateKeyWithPassphrase(tc.data, []byte(tc.passphrase))
+			var keyErr *PrivateKeyError
+			if !errors.As(err, &keyErr) {
+				t.Fatalf("expected PrivateKeyError, got: %v", err)
+			}
+			if keyErr.Format != tc.format {
+				t.Errorf("format got: %q want: %q", keyErr.Format, tc.format)
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("error got: %v want: %v", err, tc.err)
+			}
+			if !strings.Contains(err.Error(), tc.contains) {
+				t.Errorf("error got: %q want containing: %q", err, tc.contains)
+			}
+		})
+	}
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func pemBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("no PEM block found")
+	}
+	return block.Bytes
+}
@@ -0,0 +1,251 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+)
+
+const (
+	// manifestCookie is the name of the cookie storing the state between the
+	// manifest form and callback handlers.
+	manifestCookie = "ghinstallation_manifest"
+	// manifestTTL is how long a user has to create the app after the form.
+	manifestTTL = time.Hour
+)
+
+// errNoManifestCode is returned when the manifest flow callback has no code.
+var errNoManifestCode = errors.New("manifest callback contains no code")
+
+// Manifest describes a GitHub App to be created using the manifest flow.
+//
+// See https://docs.github.com/en/apps/sharing-github-apps/registering-a-github-app-from-a-manifest#github-app-manifest-parameters
+type Manifest struct {
+	Name                  string            `json:"name,omitempty"`                     // Name is the app's name, which users can change when creating it
+	URL                   string            `json:"url"`                                // URL is the homepage of the app
+	HookAttributes        *ManifestHook     `json:"hook_attributes,omitempty"`          // HookAttributes configures the app's webhook
+	RedirectURL           string            `json:"redirect_url,omitempty"`             // RedirectURL is where GitHub redirects the user after creating the app, such as to ManifestFlow's CallbackHandler
+	CallbackURLs          []string          `json:"callback_urls,omitempty"`            // CallbackURLs are the app's OAuth callback URLs
+	SetupURL              string            `json:"setup_url,omitempty"`                // SetupURL is where users are redirected after installing the app
+	Description           string            `json:"description,omitempty"`              // Description describes the app
+	Public                bool              `json:"public"`                             // Public is whether the app can be installed by anyone, or only its owner
+	DefaultEvents         []string          `json:"default_events,omitempty"`           // DefaultEvents are the webhook events the app subscribes to
+	DefaultPermissions    map[string]string `json:"default_permissions,omitempty"`      // DefaultPermissions are the app's permissions, such as {"contents": "read"}
+	RequestOAuthOnInstall bool              `json:"request_oauth_on_install,omitempty"` // RequestOAuthOnInstall is whether users authorize the app when installing it
+	SetupOnUpdate         bool              `json:"setup_on_update,omitempty"`          // SetupOnUpdate is whether users are redirected to SetupURL after updating an installation
+}
+
+// ManifestHook configures the webhook of a GitHub App created from a Manifest.
+type ManifestHook struct {
+	URL    string `json:"url"`              // URL receives webhook deliveries
+	Active *bool  `json:"active,omitempty"` // Active is whether deliveries are sent, defaults to true
+}
+
+// AppConfig is the configuration and credentials of a GitHub App created
+// using the manifest flow. Persist the secrets, which GitHub does not return
+// again.
+type AppConfig struct {
+	ID            int64  // ID is the app's ID
+	Slug          string // Slug is the app's URL-friendly name
+	Name          string // Name is the app's name
+	Owner         string // Owner is the login of the user or organization owning the app
+	HTMLURL       string // HTMLURL is the app's page on GitHub
+	ClientID      string // ClientID is the app's OAuth client ID
+	ClientSecret  Secret // ClientSecret is the app's OAuth client secret
+	WebhookSecret Secret // WebhookSecret is the secret signing webhook deliveries, or empty if the manifest has no webhook
+	PEM           Secret // PEM is the app's PEM encoded private key
+}
+
+// AppsTransport returns an AppsTransport authenticating as the app with its
+// private key. Set the returned transport's BaseURL when using GitHub
+// Enterprise Server.
+func (c *AppConfig) AppsTransport(tr http.RoundTripper) (*AppsTransport, error) {
+	return NewAppsTransport(tr, c.ID, []byte(c.PEM.Reveal()))
+}
+
+// ManifestFlow creates a GitHub App from a Manifest. FormHandler sends the
+// user to GitHub to create the app, and GitHub redirects them back to
+// CallbackHandler at the manifest's RedirectURL, which converts the temporary
+// code to the app's configuration and passes it to OnApp.
+//
+// The state is stored in a short lived, HttpOnly and Secure cookie between the
+// two handlers, so the handlers must be served over HTTPS, or from localhost
+// during development.
+//
+// See https://docs.github.com/en/apps/sharing-github-apps/registering-a-github-app-from-a-manifest
+type ManifestFlow struct {
+	Manifest     Manifest                                             // Manifest describes the app to create
+	Organization string                                               // Organization, if set, is the login of the organization owning the app, otherwise the user owns it
+	BaseURL      string                                               // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
+	WebURL       string                                               // WebURL is the scheme and host of GitHub's web interface, defaults to https://github.com
+	Client       Client                                               // Client sends requests to GitHub, defaults to http.DefaultClient
+	OnApp        func(http.ResponseWriter, *http.Request, *AppConfig) // OnApp is called by CallbackHandler with the created app, and responds to the user
+	OnError      func(http.ResponseWriter, *http.Request, error)      // OnError, if set, is called by CallbackHandler when creating the app fails, defaults to responding with the error
+}
+
+// NewManifestFlow returns a ManifestFlow creating the app described by
+// manifest, and calling onApp with the created app.
+func NewManifestFlow(manifest Manifest, onApp func(http.ResponseWriter, *http.Request, *AppConfig)) *ManifestFlow {
+	return &ManifestFlow{
+		Manifest: manifest,
+		BaseURL:  apiBaseURL,
+		WebURL:   webBaseURL,
+		Client:   http.DefaultClient,
+		OnApp:    onApp,
+	}
+}
+
+// URL returns the URL the manifest is posted to, as the manifest form field,
+// to create the app. state is returned to the manifest's RedirectURL.
+func (f *ManifestFlow) URL(state string) string {
+	webURL := strings.TrimRight(f.WebURL, "/")
+	if webURL == "" {
+		webURL = webBaseURL
+	}
+	path := "/settings/apps/new"
+	if f.Organization != "" {
+		path = "/organizations/" + url.PathEscape(f.Organization) + path
+	}
+	return webURL + path + "?" + url.Values{"state": {state}}.Encode()
+}
+
+// manifestForm posts the manifest to GitHub, submitting automatically if
+// scripts are enabled.
+var manifestForm = template.Must(template.New("manifest").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Create GitHub App</title></head>
+<body>
+<form id="manifest" method="post" action="{{.Action}}">
+<input type="hidden" name="manifest" value="{{.Manifest}}">
+<button type="submit">Create GitHub App</button>
+</form>
+<script>document.getElementById("manifest").submit()</script>
+</body>
+</html>
+`))
+
+// FormHandler returns an http.Handler which responds with a form posting the
+// manifest to GitHub, starting the manifest flow.
+func (f *ManifestFlow) FormHandler() http.Handler {
+	return http.HandlerFunc(f.form)
+}
+
+// CallbackHandler returns an http.Handler which completes the manifest flow
+// when GitHub redirects the user back to the manifest's RedirectURL,
+// converting the code to the app's configuration and calling OnApp.
+func (f *ManifestFlow) CallbackHandler() http.Handler {
+	return http.HandlerFunc(f.callback)
+}
+
+func (f *ManifestFlow) form(w http.ResponseWriter, r *http.Request) {
+	manifest, err := json.Marshal(f.Manifest)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	state, err := randomString()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, stateCookie(manifestCookie, f.Manifest.RedirectURL, state+".", int(manifestTTL/time.Second)))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = manifestForm.Execute(w, struct {
+		Action   string
+		Manifest string
+	}{f.URL(state), string(manifest)})
+}
+
+func (f *ManifestFlow) callback(w http.ResponseWriter, r *http.Request) {
+	app, err := f.convert(r)
+	// The state is single use, so remove it whether or not the flow succeeded.
+	http.SetCookie(w, stateCookie(manifestCookie, f.Manifest.RedirectURL, "", -1))
+	if err != nil {
+		if f.OnError != nil {
+			f.OnError(w, r, err)
+			return
+		}
+		status := http.StatusBadGateway
+		if errors.Is(err, ErrInvalidState) || errors.Is(err, errNoManifestCode) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	f.OnApp(w, r, app)
+}
+
+// convert validates the callback request and converts its code to the app's
+// configuration.
+func (f *ManifestFlow) convert(r *http.Request) (*AppConfig, error) {
+	if _, err := checkState(r, manifestCookie); err != nil {
+		return nil, err
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return nil, errNoManifestCode
+	}
+	return f.Convert(r.Context(), code)
+}
+
+// Convert exchanges the temporary code GitHub passes to the manifest's
+// RedirectURL for the created app's configuration. The code expires after one
+// hour and can only be converted once.
+func (f *ManifestFlow) Convert(ctx context.Context, code string) (*AppConfig, error) {
+	baseURL := strings.TrimRight(f.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = apiBaseURL
+	}
+	requestURL := baseURL + "/app-manifests/" + url.PathEscape(code) + "/conversions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %s", err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	e := &HTTPError{
+		RootCause: err,
+		Response:  redactResponse(resp),
+	}
+	if err != nil {
+		e.Message = fmt.Sprintf("could not convert app manifest code: %v", err)
+		return nil, e
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		e.Message = fmt.Sprintf("received non 2xx response status %q when converting app manifest code", resp.Status)
+		return nil, e
+	}
+
+	var config github.AppConfig
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("could not decode app configuration: %w", err)
+	}
+	return &AppConfig{
+		ID:            config.GetID(),
+		Slug:          config.GetSlug(),
+		Name:          config.GetName(),
+		Owner:         config.GetOwner().GetLogin(),
+		HTMLURL:       config.GetHTMLURL(),
+		ClientID:      config.GetClientID(),
+		ClientSecret:  Secret(config.GetClientSecret()),
+		WebhookSecret: Secret(config.GetWebhookSecret()),
+		PEM:           Secret(config.GetPEM()),
+	}, nil
+}
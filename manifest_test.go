@@ -0,0 +1,120 @@
+package ghinstallation
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestManifestFlow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app-manifests/code/conversions" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":             appID,
+			"slug":           "octoapp",
+			"owner":          map[string]any{"login": "octo-org"},
+			"client_id":      "Iv1.abc",
+			"client_secret":  "secret",
+			"webhook_secret": "webhook",
+			"pem":            string(key),
+		})
+	}))
+	defer ts.Close()
+
+	manifest := Manifest{
+		Name:               "octoapp",
+		URL:                "https://example.com",
+		HookAttributes:     &ManifestHook{URL: "https://example.com/webhook"},
+		RedirectURL:        "https://example.com/manifest/callback",
+		DefaultPermissions: map[string]string{"contents": "read"},
+	}
+	var got *AppConfig
+	flow := NewManifestFlow(manifest, func(w http.ResponseWriter, r *http.Request, app *AppConfig) {
+		got = app
+	})
+	flow.BaseURL = ts.URL
+	flow.Organization = "octo-org"
+
+	form := httptest.NewRecorder()
+	flow.FormHandler().ServeHTTP(form, httptest.NewRequest(http.MethodGet, "/manifest", nil))
+	cookies := form.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/manifest/callback" {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+	body := form.Body.String()
+	action := regexp.MustCompile(`action="([^"]*)"`).FindStringSubmatch(body)
+	value := regexp.MustCompile(`name="manifest" value="([^"]*)"`).FindStringSubmatch(body)
+	if action == nil || value == nil {
+		t.Fatalf("unexpected form: %s", body)
+	}
+	actionURL, err := url.Parse(html.UnescapeString(action[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actionURL.Path != "/organizations/octo-org/settings/apps/new" {
+		t.Errorf("form action got: %v", actionURL)
+	}
+	var posted Manifest
+	if err := json.Unmarshal([]byte(html.UnescapeString(value[1])), &posted); err != nil {
+		t.Fatal(err)
+	}
+	if posted.RedirectURL != manifest.RedirectURL || posted.DefaultPermissions["contents"] != "read" {
+		t.Errorf("form manifest got: %+v", posted)
+	}
+
+	callback := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/manifest/callback?"+query, nil)
+		req.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		flow.CallbackHandler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := callback("code=code&state=forged"); rec.Code != http.StatusBadRequest || got != nil {
+		t.Errorf("forged state status got: %v want: %v", rec.Code, http.StatusBadRequest)
+	}
+
+	rec := callback("code=code&state=" + actionURL.Query().Get("state"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback status got: %v, body: %s", rec.Code, rec.Body)
+	}
+	if got == nil || got.ID != appID || got.Owner != "octo-org" || got.ClientSecret.Reveal() != "secret" || got.WebhookSecret.Reveal() != "webhook" {
+		t.Fatalf("OnApp got: %+v", got)
+	}
+	atr, err := got.AppsTransport(http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atr.AppID() != appID {
+		t.Errorf("AppID got: %v want: %v", atr.AppID(), appID)
+	}
+}
+
+func TestManifestFlowURL(t *testing.T) {
+	flow := NewManifestFlow(Manifest{}, nil)
+	flow.WebURL = "https://github.example.com/"
+	if got, want := flow.URL("abc"), "https://github.example.com/settings/apps/new?state=abc"; got != want {
+		t.Errorf("URL got: %q want: %q", got, want)
+	}
+}
+
+func TestManifestFlowConvertError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	flow := NewManifestFlow(Manifest{}, nil)
+	flow.BaseURL = ts.URL
+	_, err := flow.Convert(t.Context(), "expired")
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprint(http.StatusNotFound)) {
+		t.Errorf("expected 404 error, got: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	webBaseURL = "https://github.com"
+
+	// maxOAuthResponseSize limits the size of OAuth responses read.
+	maxOAuthResponseSize = 1 << 20
+)
+
+// UserToken is an OAuth user access token, authenticating as a user on behalf
+// of a GitHub App, and the refresh token used to renew it.
+//
+// The tokens are Secrets, which are redacted when formatted or logged.
+// UserToken itself marshals to and unmarshals from JSON including the tokens,
+// so it can be persisted, such as in UserTransport's OnRefresh, and restored.
+// Refresh tokens are single use, so persist each renewed token.
+type UserToken struct {
+	AccessToken           Secret    // AccessToken authenticates as the user
+	ExpiresAt             time.Time // ExpiresAt is when AccessToken expires, or zero if it does not expire
+	RefreshToken          Secret    // RefreshToken renews AccessToken, or empty if AccessToken does not expire
+	RefreshTokenExpiresAt time.Time // RefreshTokenExpiresAt is when RefreshToken expires, or zero if unknown
+	Scope                 string    // Scope is the token's OAuth scopes, which are empty for GitHub Apps
+}
+
+var (
+	_ json.Marshaler   = UserToken{}
+	_ json.Unmarshaler = &UserToken{}
+	_ slog.LogValuer   = UserToken{}
+)
+
+// userTokenJSON is the persisted form of a UserToken, with its tokens
+// revealed.
+type userTokenJSON struct {
+	AccessToken           string    `json:"access_token,omitempty"`
+	ExpiresAt             time.Time `json:"expires_at,omitzero"`
+	RefreshToken          string    `json:"refresh_token,omitempty"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at,omitzero"`
+	Scope                 string    `json:"scope,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, marshalling the token including its
+// secrets, so it can be persisted and restored with UnmarshalJSON.
+func (t UserToken) MarshalJSON() ([]byte, error) {
+	return json.Marshal(userTokenJSON{
+		AccessToken:           t.AccessToken.Reveal(),
+		ExpiresAt:             t.ExpiresAt,
+		RefreshToken:          t.RefreshToken.Reveal(),
+		RefreshTokenExpiresAt: t.RefreshTokenExpiresAt,
+		Scope:                 t.Scope,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, restoring a token marshalled by
+// MarshalJSON.
+func (t *UserToken) UnmarshalJSON(data []byte) error {
+	var v userTokenJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*t = UserToken{
+		AccessToken:           Secret(v.AccessToken),
+		ExpiresAt:             v.ExpiresAt,
+		RefreshToken:          Secret(v.RefreshToken),
+		RefreshTokenExpiresAt: v.RefreshTokenExpiresAt,
+		Scope:                 v.Scope,
+	}
+	return nil
+}
+
+// LogValue implements slog.LogValuer, logging the token with its secrets
+// redacted, as MarshalJSON reveals them.
+func (t UserToken) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Any("access_token", t.AccessToken),
+		slog.Time("expires_at", t.ExpiresAt),
+		slog.Any("refresh_token", t.RefreshToken),
+		slog.Time("refresh_token_expires_at", t.RefreshTokenExpiresAt),
+		slog.String("scope", t.Scope),
+	)
+}
+
+// OAuthError is an error returned by GitHub's OAuth endpoints, such as
+// "bad_refresh_token" or "authorization_pending".
+type OAuthError struct {
+	Code        string `json:"error"`             // Code identifies the error
+	Description string `json:"error_description"` // Description describes the error
+	URI         string `json:"error_uri"`         // URI is a link to documentation about the error
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// oauthTokenResponse is a response from GitHub's OAuth token endpoint.
+type oauthTokenResponse struct {
+	OAuthError
+	AccessToken           string `json:"access_token"`
+	ExpiresIn             int64  `json:"expires_in"`
+	RefreshToken          string `json:"refresh_token"`
+	RefreshTokenExpiresIn int64  `json:"refresh_token_expires_in"`
+	Scope                 string `json:"scope"`
+	TokenType             string `json:"token_type"`
+	Interval              int64  `json:"interval"` // Interval is the new polling interval of the device flow after a slow_down error
+}
+
+// userToken returns the UserToken of the response, received at now.
+func (r *oauthTokenResponse) userToken(now time.Time) *UserToken {
+	token := &UserToken{
+		AccessToken:  Secret(r.AccessToken),
+		RefreshToken: Secret(r.RefreshToken),
+		Scope:        r.Scope,
+	}
+	if r.ExpiresIn > 0 {
+		token.ExpiresAt = now.Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+	if r.RefreshTokenExpiresIn > 0 {
+		token.RefreshTokenExpiresAt = now.Add(time.Duration(r.RefreshTokenExpiresIn) * time.Second)
+	}
+	return token
+}
+
+// postOAuth posts form to the OAuth endpoint at path of the web URL, decoding
+// the JSON response into v. GitHub reports OAuth errors with a 200 OK status,
+// so errors are returned as a *HTTPError whose RootCause is an *OAuthError if
+// the response contains an error code.
+func postOAuth(ctx context.Context, client Client, webURL, path string, form url.Values, v interface{ oauthError() *OAuthError }) error {
+	if webURL == "" {
+		webURL = webBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(webURL, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("could not create request: %s", err)
+	}
+	// The body contains credentials, so must not be available from errors.
+	req.GetBody = nil
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	e := &HTTPError{
+		RootCause: err,
+		Response:  redactResponse(resp),
+	}
+	if err != nil {
+		e.Message = fmt.Sprintf("could not post to %s: %v", path, err)
+		return e
+	}
+	defer resp.Body.Close()
+
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, maxOAuthResponseSize)).Decode(v)
+	switch oauthErr := v.oauthError(); {
+	case decodeErr == nil && oauthErr.Code != "":
+		e.RootCause = oauthErr
+		e.Message = fmt.Sprintf("%s returned error: %v", path, oauthErr)
+	case resp.StatusCode/100 != 2:
+		e.Message = fmt.Sprintf("received non 2xx response status %q when posting to %s", resp.Status, path)
+	case decodeErr != nil:
+		e.RootCause = decodeErr
+		e.Message = fmt.Sprintf("could not decode %s response: %v", path, decodeErr)
+	default:
+		return nil
+	}
+	return e
+}
+
+func (e *OAuthError) oauthError() *OAuthError {
+	return e
+}
+
+// exchangeToken requests a user access token from the OAuth token endpoint.
+func exchangeToken(ctx context.Context, client Client, webURL string, form url.Values, now time.Time) (*UserToken, error) {
+	var resp oauthTokenResponse
+	if err := postOAuth(ctx, client, webURL, "/login/oauth/access_token", form, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, &HTTPError{Message: "/login/oauth/access_token response contains no access token"}
+	}
+	return resp.userToken(now), nil
+}
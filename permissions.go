@@ -0,0 +1,290 @@
+package ghinstallation
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v88/github"
+)
+
+const (
+	permissionRead  = "read"
+	permissionWrite = "write"
+
+	// maxUnmatched limits the number of distinct unmatched routes recorded.
+	maxUnmatched = 1000
+)
+
+// routeParameters maps path segments to the name of the parameter following
+// them, used to normalise unmatched requests to routes.
+var routeParameters = map[string]string{
+	"enterprises":   "{enterprise}",
+	"installations": "{installation_id}",
+	"orgs":          "{org}",
+	"users":         "{username}",
+}
+
+// endpointPermission maps API routes to the GitHub App permission they
+// require.
+type endpointPermission struct {
+	method     string // method is the HTTP method the route applies to, or empty for any method
+	pattern    string // pattern is the route, where {name} matches any single path segment
+	exact      bool   // exact requires the path to match pattern exactly, rather than being prefixed by it
+	permission string // permission is the name of the permission as used by InstallationPermissions
+}
+
+// endpointPermissions is the table of known API routes. A request is matched
+// against the longest matching pattern, preferring those with a method. The
+// level of access is read for safe methods and write otherwise.
+//
+// See https://docs.github.com/en/rest/authentication/permissions-required-for-github-apps
+var endpointPermissions = []endpointPermission{
+	{method: http.MethodGet, pattern: "/repos/{owner}/{repo}", exact: true, permission: "metadata"},
+	{pattern: "/repos/{owner}/{repo}", exact: true, permission: "administration"},
+	{pattern: "/repos/{owner}/{repo}/actions", permission: "actions"},
+	{pattern: "/repos/{owner}/{repo}/actions/secrets", permission: "secrets"},
+	{pattern: "/repos/{owner}/{repo}/actions/variables", permission: "actions_variables"},
+	{pattern: "/repos/{owner}/{repo}/actions/runners", permission: "administration"},
+	{pattern: "/repos/{owner}/{repo}/branches", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/branches/{branch}/protection", permission: "administration"},
+	{pattern: "/repos/{owner}/{repo}/check-runs", permission: "checks"},
+	{pattern: "/repos/{owner}/{repo}/check-suites", permission: "checks"},
+	{pattern: "/repos/{owner}/{repo}/code-scanning", permission: "security_events"},
+	{pattern: "/repos/{owner}/{repo}/collaborators", permission: "metadata"},
+	{method: http.MethodPut, pattern: "/repos/{owner}/{repo}/collaborators", permission: "administration"},
+	{method: http.MethodDelete, pattern: "/repos/{owner}/{repo}/collaborators", permission: "administration"},
+	{pattern: "/repos/{owner}/{repo}/commits", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/commits/{ref}/check-runs", permission: "checks"},
+	{pattern: "/repos/{owner}/{repo}/commits/{ref}/check-suites", permission: "checks"},
+	{pattern: "/repos/{owner}/{repo}/commits/{ref}/status", permission: "statuses"},
+	{pattern: "/repos/{owner}/{repo}/commits/{ref}/statuses", permission: "statuses"},
+	{pattern: "/repos/{owner}/{repo}/compare", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/contents", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/dependabot/alerts", permission: "vulnerability_alerts"},
+	{pattern: "/repos/{owner}/{repo}/dependabot/secrets", permission: "dependabot_secrets"},
+	{pattern: "/repos/{owner}/{repo}/deployments", permission: "deployments"},
+	{pattern: "/repos/{owner}/{repo}/discussions", permission: "discussions"},
+	{pattern: "/repos/{owner}/{repo}/dispatches", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/environments", permission: "environments"},
+	{pattern: "/repos/{owner}/{repo}/forks", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/git", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/hooks", permission: "repository_hooks"},
+	{pattern: "/repos/{owner}/{repo}/issues", permission: "issues"},
+	{pattern: "/repos/{owner}/{repo}/keys", permission: "administration"},
+	{pattern: "/repos/{owner}/{repo}/labels", permission: "issues"},
+	{pattern: "/repos/{owner}/{repo}/merges", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/milestones", permission: "issues"},
+	{pattern: "/repos/{owner}/{repo}/pages", permission: "pages"},
+	{pattern: "/repos/{owner}/{repo}/projects", permission: "repository_projects"},
+	{pattern: "/repos/{owner}/{repo}/pulls", permission: "pull_requests"},
+	{pattern: "/repos/{owner}/{repo}/readme", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/releases", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/secret-scanning", permission: "secret_scanning_alerts"},
+	{pattern: "/repos/{owner}/{repo}/security-advisories", permission: "repository_advisories"},
+	{pattern: "/repos/{owner}/{repo}/statuses", permission: "statuses"},
+	{pattern: "/repos/{owner}/{repo}/tags", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/tarball", permission: "contents"},
+	{pattern: "/repos/{owner}/{repo}/teams", permission: "metadata"},
+	{pattern: "/repos/{owner}/{repo}/topics", permission: "metadata"},
+	{method: http.MethodPut, pattern: "/repos/{owner}/{repo}/topics", permission: "administration"},
+	{pattern: "/repos/{owner}/{repo}/zipball", permission: "contents"},
+	{pattern: "/orgs/{org}/actions/secrets", permission: "organization_secrets"},
+	{pattern: "/orgs/{org}/actions/runners", permission: "organization_self_hosted_runners"},
+	{pattern: "/orgs/{org}/actions/variables", permission: "organization_actions_variables"},
+	{pattern: "/orgs/{org}/dependabot/secrets", permission: "organization_dependabot_secrets"},
+	{pattern: "/orgs/{org}/hooks", permission: "organization_hooks"},
+	{pattern: "/orgs/{org}/members", permission: "members"},
+	{pattern: "/orgs/{org}/memberships", permission: "members"},
+	{pattern: "/orgs/{org}/packages", permission: "packages"},
+	{pattern: "/orgs/{org}/projects", permission: "organization_projects"},
+	{pattern: "/orgs/{org}/teams", permission: "members"},
+	{pattern: "/users/{username}/packages", permission: "packages"},
+}
+
+// PermissionRecorder records the GitHub App permissions exercised by requests,
+// so that a minimal set of permissions can be requested. Set it as a
+// Transport's PermissionRecorder to record all requests made using the
+// Transport.
+//
+// PermissionRecorder is safe to be used concurrently.
+type PermissionRecorder struct {
+	mu          sync.Mutex
+	permissions map[string]string // permissions maps permission names to the highest level of access recorded
+	unmatched   map[string]bool   // unmatched are routes not found in the endpoint table, as "METHOD /route"
+}
+
+// PermissionReport is a summary of the permissions recorded by a
+// PermissionRecorder.
+type PermissionReport struct {
+	// Permissions maps permission names, such as "contents", to the level of
+	// access required, either "read" or "write". The map is in the format of an
+	// app manifest's default_permissions.
+	Permissions map[string]string `json:"permissions"`
+	// Unmatched lists routes, as "METHOD /route" such as
+	// "GET /users/{username}", that could not be mapped to a permission and
+	// need to be reviewed manually. At most 1000 routes are listed.
+	Unmatched []string `json:"unmatched,omitempty"`
+}
+
+// NewPermissionRecorder returns an empty PermissionRecorder.
+func NewPermissionRecorder() *PermissionRecorder {
+	return &PermissionRecorder{
+		permissions: make(map[string]string),
+		unmatched:   make(map[string]bool),
+	}
+}
+
+// Record records the permission required by a request with method to the API
+// path, such as /repos/{owner}/{repo}/issues. The path must not include the
+// prefix of a GitHub Enterprise Server's base URL.
+//
+// Requests not in the endpoint table are recorded by route, replacing IDs and
+// names of users, organizations and repositories with parameters, so that
+// recording many requests does not record each one.
+func (r *PermissionRecorder) Record(method, path string) {
+	permission, level, ok := requiredPermission(method, path)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !ok {
+		if key := method + " " + route(path); r.unmatched[key] || len(r.unmatched) < maxUnmatched {
+			r.unmatched[key] = true
+		}
+		return
+	}
+	if r.permissions[permission] != permissionWrite {
+		r.permissions[permission] = level
+	}
+}
+
+// Report returns the permissions recorded so far.
+func (r *PermissionRecorder) Report() PermissionReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := PermissionReport{Permissions: make(map[string]string, len(r.permissions))}
+	for permission, level := range r.permissions {
+		report.Permissions[permission] = level
+	}
+	for req := range r.unmatched {
+		report.Unmatched = append(report.Unmatched, req)
+	}
+	sort.Strings(report.Unmatched)
+	return report
+}
+
+// InstallationPermissions returns the recorded permissions as
+// InstallationPermissions.
+func (r PermissionReport) InstallationPermissions() (*github.InstallationPermissions, error) {
+	js, err := json.Marshal(r.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	var permissions github.InstallationPermissions
+	if err := json.Unmarshal(js, &permissions); err != nil {
+		return nil, err
+	}
+	return &permissions, nil
+}
+
+// InstallationTokenOptions returns options restricting an installation token
+// to the recorded permissions, suitable for Transport's
+// InstallationTokenOptions.
+func (r PermissionReport) InstallationTokenOptions() (*github.InstallationTokenOptions, error) {
+	permissions, err := r.InstallationPermissions()
+	if err != nil {
+		return nil, err
+	}
+	return &github.InstallationTokenOptions{Permissions: permissions}, nil
+}
+
+// requiredPermission returns the permission and level of access required by a
+// request with method to path, and whether the request is in the endpoint
+// table.
+func requiredPermission(method, path string) (permission, level string, ok bool) {
+	segments := splitPath(path)
+	best := -1
+	for _, ep := range endpointPermissions {
+		if ep.method != "" && ep.method != method {
+			continue
+		}
+		pattern := splitPath(ep.pattern)
+		if !matchSegments(pattern, segments, ep.exact) {
+			continue
+		}
+		score := 2 * len(pattern)
+		if ep.method != "" {
+			score++
+		}
+		if score > best {
+			best, permission = score, ep.permission
+		}
+	}
+	if best < 0 {
+		return "", "", false
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return permission, permissionRead, true
+	default:
+		return permission, permissionWrite, true
+	}
+}
+
+// matchSegments reports whether path matches pattern, or is prefixed by it if
+// exact is false.
+func matchSegments(pattern, path []string, exact bool) bool {
+	if len(path) < len(pattern) || (exact && len(path) != len(pattern)) {
+		return false
+	}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if path[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// route normalises path to its route, replacing numeric IDs and the
+// names of users, organizations and repositories with parameters, such as
+// /users/{username} for /users/octocat.
+func route(path string) string {
+	segments := splitPath(path)
+	for i, s := range segments {
+		switch {
+		case segments[0] == "repos" && i == 1:
+			segments[i] = "{owner}"
+		case segments[0] == "repos" && i == 2:
+			segments[i] = "{repo}"
+		case i > 0 && routeParameters[segments[i-1]] != "":
+			segments[i] = routeParameters[segments[i-1]]
+		case isNumeric(s):
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// isNumeric reports whether s is a non-empty string of digits.
+func isNumeric(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// splitPath splits path into its segments, ignoring leading and trailing
+// slashes.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,133 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v88/github"
+)
+
+func TestRequiredPermission(t *testing.T) {
+	for _, tc := range []struct {
+		method, path      string
+		permission, level string
+		ok                bool
+	}{
+		{"GET", "/repos/o/r", "metadata", "read", true},
+		{"PATCH", "/repos/o/r", "administration", "write", true},
+		{"GET", "/repos/o/r/issues/1/comments", "issues", "read", true},
+		{"POST", "/repos/o/r/pulls", "pull_requests", "write", true},
+		{"GET", "/repos/o/r/commits/abc", "contents", "read", true},
+		{"POST", "/repos/o/r/statuses/abc", "statuses", "write", true},
+		{"GET", "/repos/o/r/commits/abc/status", "statuses", "read", true},
+		{"GET", "/repos/o/r/actions/secrets/public-key", "secrets", "read", true},
+		{"GET", "/repos/o/r/collaborators", "metadata", "read", true},
+		{"PUT", "/repos/o/r/collaborators/u", "administration", "write", true},
+		{"GET", "/orgs/o/members/", "members", "read", true},
+		{"GET", "/repos/o/r/unknown", "", "", false},
+		{"GET", "/repos/o", "", "", false},
+		{"GET", "/user", "", "", false},
+	} {
+		permission, level, ok := requiredPermission(tc.method, tc.path)
+		if permission != tc.permission || level != tc.level || ok != tc.ok {
+			t.Errorf("requiredPermission(%q, %q) got: %q, %q, %v want: %q, %q, %v",
+				tc.method, tc.path, permission, level, ok, tc.permission, tc.level, tc.ok)
+		}
+	}
+}
+
+func TestPermissionRecorderUnmatched(t *testing.T) {
+	rec := NewPermissionRecorder()
+	for _, path := range []string{
+		"/users/alice",
+		"/users/bob",
+		"/orgs/x/installation",
+		"/orgs/y/installation",
+		"/repos/o/r/community/profile",
+		"/app/installations/1",
+		"/app/installations/2",
+		"/marketplace_listing/plans/7/accounts",
+	} {
+		rec.Record(http.MethodGet, path)
+	}
+	want := []string{
+		"GET /app/installations/{installation_id}",
+		"GET /marketplace_listing/plans/{id}/accounts",
+		"GET /orgs/{org}/installation",
+		"GET /repos/{owner}/{repo}/community/profile",
+		"GET /users/{username}",
+	}
+	if diff := cmp.Diff(want, rec.Report().Unmatched); diff != "" {
+		t.Errorf("unmatched want->got: %s", diff)
+	}
+
+	// Unmatched routes are capped, so recording does not grow without bound.
+	for i := range 2 * maxUnmatched {
+		rec.Record(http.MethodGet, fmt.Sprintf("/unknown/route-%d", i))
+	}
+	if got := len(rec.Report().Unmatched); got != maxUnmatched {
+		t.Errorf("unmatched routes got: %d want: %d", got, maxUnmatched)
+	}
+}
+
+func TestPermissionRecorder(t *testing.T) {
+	rec := NewPermissionRecorder()
+	tr := &Transport{
+		BaseURL: "https://github.example.com/api/v3",
+		token: &accessToken{
+			ExpiresAt: time.Now().Add(1 * time.Hour),
+			Token:     token,
+		},
+		mu:                 &sync.Mutex{},
+		PermissionRecorder: rec,
+		tr: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, nil
+		}),
+	}
+
+	for _, r := range []struct{ method, path string }{
+		{"GET", "/api/v3/repos/o/r/issues"},
+		{"POST", "/api/v3/repos/o/r/issues/1/comments"},
+		{"GET", "/api/v3/repos/o/r/issues/1"},
+		{"GET", "/api/v3/repos/o/r/contents/README.md"},
+		{"GET", "/api/v3/rate_limit"},
+	} {
+		req, err := http.NewRequest(r.method, "https://github.example.com"+r.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tr.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := rec.Report()
+	want := PermissionReport{
+		Permissions: map[string]string{
+			"issues":   "write",
+			"contents": "read",
+		},
+		Unmatched: []string{"GET /rate_limit"},
+	}
+	if diff := cmp.Diff(want, report); diff != "" {
+		t.Errorf("report want->got: %s", diff)
+	}
+
+	opts, err := report.InstallationTokenOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOpts := &github.InstallationTokenOptions{
+		Permissions: &github.InstallationPermissions{
+			Issues:   github.Ptr("write"),
+			Contents: github.Ptr("read"),
+		},
+	}
+	if diff := cmp.Diff(wantOpts, opts); diff != "" {
+		t.Errorf("InstallationTokenOptions want->got: %s", diff)
+	}
+}
@@ -0,0 +1,237 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// defaultRemoteSignerTimeout limits how long a RemoteSigner waits for the
+	// signing service.
+	defaultRemoteSignerTimeout = 10 * time.Second
+	// maxJWTLifetime is the longest lifetime of a JWT accepted by GitHub.
+	maxJWTLifetime = 10 * time.Minute
+	// maxClockSkew is how far in the future a JWT's iat claim may be.
+	maxClockSkew = time.Minute
+	// maxSignRequestSize limits the size of requests and responses of signing
+	// services.
+	maxSignRequestSize = 64 << 10
+)
+
+// RemoteSigner signs JWT tokens using a remote signing service, allowing the
+// GitHub App's private key to be held by a single hardened service.
+//
+// The service is sent a SignRequest as the JSON body of a POST request, and
+// responds with a SignResponse. SigningHandler is a reference implementation
+// of the service.
+//
+// Authenticate with the service using BearerToken, or mTLS by configuring
+// the client certificate of Client's http.Transport.
+type RemoteSigner struct {
+	URL         string // URL is the URL of the signing service
+	Client      Client // Client sends requests to the signing service, defaults to http.Client with a 10 second timeout
+	BearerToken Secret // BearerToken, if set, is sent in the Authorization header
+}
+
+var _ Signer = &RemoteSigner{}
+
+// NewRemoteSigner returns a RemoteSigner using the signing service at url.
+func NewRemoteSigner(url string) *RemoteSigner {
+	return &RemoteSigner{
+		URL:    url,
+		Client: &http.Client{Timeout: defaultRemoteSignerTimeout},
+	}
+}
+
+// Sign signs the JWT claims using the signing service. If the service fails,
+// the error is a *HTTPError whose RootCause is the *SignError reported by the
+// service, if any.
+func (s *RemoteSigner) Sign(claims jwt.Claims) (string, error) {
+	js, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal claims: %w", err)
+	}
+	body, err := json.Marshal(SignRequest{APIVersion: SignAPIVersion, Claims: js})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("could not create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if s.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.BearerToken.Reveal())
+	}
+
+	resp, err := s.client().Do(req)
+	e := &HTTPError{
+		RootCause: err,
+		Response:  redactResponse(resp),
+	}
+	if err != nil {
+		e.Message = fmt.Sprintf("could not reach signing service: %v", err)
+		return "", e
+	}
+	defer resp.Body.Close()
+
+	var signResp SignResponse
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, maxSignRequestSize)).Decode(&signResp)
+	switch {
+	case signResp.Error != nil:
+		e.RootCause = signResp.Error
+		e.Message = fmt.Sprintf("signing service returned status %q: %v", resp.Status, signResp.Error)
+	case resp.StatusCode/100 != 2:
+		e.Message = fmt.Sprintf("received non 2xx response status %q from signing service", resp.Status)
+	case decodeErr != nil:
+		e.RootCause = decodeErr
+		e.Message = fmt.Sprintf("could not decode signing service response: %v", decodeErr)
+	case signResp.Token == "":
+		e.Message = "signing service response contains no token"
+	default:
+		return signResp.Token, nil
+	}
+	return "", e
+}
+
+func (s *RemoteSigner) client() Client {
+	if s.Client == nil {
+		return &http.Client{Timeout: defaultRemoteSignerTimeout}
+	}
+	return s.Client
+}
+
+// SigningHandler is a reference implementation of the signing service used by
+// RemoteSigner, signing JWTs for a single GitHub App.
+//
+// Only JWTs suitable for authenticating as the app are signed: the iss claim
+// must be the app's ID, and the exp and iat claims must be set, valid and at
+// most MaxLifetime apart. Claims other than the registered claims are not
+// signed.
+//
+// Requests must be authenticated with BearerToken, or with mTLS by serving the
+// handler from an http.Server requiring and verifying client certificates and
+// setting RequireClientCertificate. If neither is set, all requests are
+// refused unless AllowUnauthenticated is set.
+type SigningHandler struct {
+	Signer                   Signer        // Signer signs the JWTs, such as an RSASigner with the app's private key
+	AppID                    int64         // AppID is the GitHub App's ID, the only issuer JWTs are signed for
+	BearerToken              Secret        // BearerToken, if set, must be sent in the Authorization header of requests
+	RequireClientCertificate bool          // RequireClientCertificate rejects requests without a verified TLS client certificate
+	AllowUnauthenticated     bool          // AllowUnauthenticated signs JWTs for any client when neither BearerToken nor RequireClientCertificate is set, such as when the network restricts access
+	MaxLifetime              time.Duration // MaxLifetime is the longest lifetime of JWTs signed, defaults to 10 minutes
+}
+
+var _ http.Handler = &SigningHandler{}
+
+// NewSigningHandler returns a SigningHandler signing JWTs for appID with
+// signer.
+func NewSigningHandler(signer Signer, appID int64) *SigningHandler {
+	return &SigningHandler{
+		Signer:      signer,
+		AppID:       appID,
+		MaxLifetime: maxJWTLifetime,
+	}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *SigningHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeSignError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only POST is supported")
+		return
+	}
+	if h.BearerToken == "" && !h.RequireClientCertificate && !h.AllowUnauthenticated {
+		writeSignError(w, http.StatusInternalServerError, "unauthenticated", "signing service has no authentication configured")
+		return
+	}
+	if h.RequireClientCertificate && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		writeSignError(w, http.StatusUnauthorized, "unauthorized", "verified client certificate required")
+		return
+	}
+	if h.BearerToken != "" {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(h.BearerToken.Reveal())) != 1 {
+			writeSignError(w, http.StatusUnauthorized, "unauthorized", "invalid bearer token")
+			return
+		}
+	}
+
+	var req SignRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSignRequestSize)).Decode(&req); err != nil {
+		writeSignError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("could not decode request: %v", err))
+		return
+	}
+	if req.APIVersion != SignAPIVersion {
+		writeSignError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("unsupported apiVersion %q, expected %q", req.APIVersion, SignAPIVersion))
+		return
+	}
+	var claims jwt.RegisteredClaims
+	if err := json.Unmarshal(req.Claims, &claims); err != nil {
+		writeSignError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("could not decode claims: %v", err))
+		return
+	}
+	if code, err := h.validate(&claims); err != nil {
+		writeSignError(w, code, "invalid_claims", err.Error())
+		return
+	}
+
+	ss, err := h.Signer.Sign(&claims)
+	if err != nil {
+		writeSignError(w, http.StatusInternalServerError, "signing_failed", err.Error())
+		return
+	}
+	writeSignResponse(w, http.StatusOK, SignResponse{APIVersion: SignAPIVersion, Token: ss})
+}
+
+// validate returns an error and the response status code if claims are not
+// suitable for authenticating as the app.
+func (h *SigningHandler) validate(claims *jwt.RegisteredClaims) (int, error) {
+	if claims.Issuer != strconv.FormatInt(h.AppID, 10) {
+		return http.StatusForbidden, fmt.Errorf("issuer %q is not app ID %d", claims.Issuer, h.AppID)
+	}
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return http.StatusBadRequest, errors.New("iat and exp claims are required")
+	}
+	maxLifetime := h.MaxLifetime
+	if maxLifetime <= 0 {
+		maxLifetime = maxJWTLifetime
+	}
+	now := time.Now()
+	switch {
+	case claims.IssuedAt.After(now.Add(maxClockSkew)):
+		return http.StatusBadRequest, errors.New("iat claim is in the future")
+	case !claims.ExpiresAt.After(now):
+		return http.StatusBadRequest, errors.New("exp claim is in the past")
+	case claims.ExpiresAt.Sub(claims.IssuedAt.Time) > maxLifetime:
+		return http.StatusBadRequest, fmt.Errorf("lifetime exceeds %v", maxLifetime)
+	}
+	return http.StatusOK, nil
+}
+
+// writeSignError writes a SignResponse reporting an error.
+func writeSignError(w http.ResponseWriter, status int, code, message string) {
+	writeSignResponse(w, status, SignResponse{
+		APIVersion: SignAPIVersion,
+		Error:      &SignError{Code: code, Message: message},
+	})
+}
+
+// writeSignResponse writes resp as JSON with status.
+func writeSignResponse(w http.ResponseWriter, status int, resp SignResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
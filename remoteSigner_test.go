@@ -0,0 +1,156 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewSigningHandler(NewRSASigner(jwt.SigningMethodRS256, key), appID)
+	handler.BearerToken = "s3cret"
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	signer := NewRemoteSigner(ts.URL)
+	signer.BearerToken = "s3cret"
+
+	check := RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			ss := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			var claims jwt.RegisteredClaims
+			if _, err := jwt.ParseWithClaims(ss, &claims, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil }); err != nil {
+				t.Errorf("could not verify JWT: %v", err)
+			}
+			if claims.Issuer != "2" {
+				t.Errorf("iss got: %q want: %q", claims.Issuer, "2")
+			}
+			return nil, nil
+		},
+	}
+	tr, err := NewAppsTransportWithOptions(check, appID, WithSigner(signer))
+	if err != nil {
+		t.Fatalf("NewAppsTransportWithOptions: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", new(bytes.Buffer))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("error calling RoundTrip: %v", err)
+	}
+}
+
+func TestRemoteSignerDefaultClient(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewSigningHandler(NewRSASigner(jwt.SigningMethodRS256, key), appID)
+	handler.BearerToken = "s3cret"
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	signer := &RemoteSigner{URL: ts.URL, BearerToken: "s3cret"}
+	now := time.Now()
+	if _, err := signer.Sign(&jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		Issuer:    "2",
+	}); err != nil {
+		t.Errorf("Sign: %v", err)
+	}
+}
+
+func TestRemoteSignerErrors(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewSigningHandler(NewRSASigner(jwt.SigningMethodRS256, key), appID)
+	handler.BearerToken = "s3cret"
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	now := time.Now().Truncate(time.Second)
+	valid := jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(2 * time.Minute)),
+		Issuer:    "2",
+	}
+
+	for _, tc := range []struct {
+		name   string
+		token  Secret
+		claims func(c *jwt.RegisteredClaims)
+		status int
+		code   string
+	}{
+		{name: "bearer token", token: "wrong", status: http.StatusUnauthorized, code: "unauthorized"},
+		{name: "issuer", token: "s3cret", claims: func(c *jwt.RegisteredClaims) { c.Issuer = "3" }, status: http.StatusForbidden, code: "invalid_claims"},
+		{name: "lifetime", token: "s3cret", claims: func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(time.Hour)) }, status: http.StatusBadRequest, code: "invalid_claims"},
+		{name: "expired", token: "s3cret", claims: func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }, status: http.StatusBadRequest, code: "invalid_claims"},
+		{name: "missing iat", token: "s3cret", claims: func(c *jwt.RegisteredClaims) { c.IssuedAt = nil }, status: http.StatusBadRequest, code: "invalid_claims"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			signer := NewRemoteSigner(ts.URL)
+			signer.BearerToken = tc.token
+			claims := valid
+			if tc.claims != nil {
+				tc.claims(&claims)
+			}
+
+			_, err := signer.Sign(&claims)
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("expected HTTPError, got: %v", err)
+			}
+			if httpErr.Response.StatusCode != tc.status {
+				t.Errorf("status got: %d want: %d", httpErr.Response.StatusCode, tc.status)
+			}
+			var signErr *SignError
+			if !errors.As(err, &signErr) || signErr.Code != tc.code {
+				t.Errorf("expected SignError with code %q, got: %v", tc.code, err)
+			}
+			if auth := httpErr.Response.Request.Header.Get("Authorization"); strings.Contains(auth, tc.token.Reveal()) {
+				t.Errorf("HTTPError revealed bearer token: %q", auth)
+			}
+		})
+	}
+}
+
+func TestSigningHandlerRequireClientCertificate(t *testing.T) {
+	handler := NewSigningHandler(noopSigner{}, appID)
+	handler.RequireClientCertificate = true
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status got: %d want: %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSigningHandlerUnauthenticated(t *testing.T) {
+	handler := NewSigningHandler(noopSigner{}, appID)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), `"unauthenticated"`) {
+		t.Errorf("status got: %d want: %d, body: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+	}
+
+	handler.AllowUnauthenticated = true
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status got: %d want: %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,98 @@
+package ghinstallation
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// RotatingKey is a key used by a RotatingSigner.
+type RotatingKey struct {
+	Name   string // Name identifies the key in KeyUsage, such as by its fingerprint
+	Signer Signer // Signer signs JWTs with the key
+}
+
+// KeyUsage reports how often GitHub accepted JWTs signed by a RotatingSigner's
+// key. A key without successes since the new key was added is no longer in use
+// and can be deleted from the GitHub App.
+type KeyUsage struct {
+	Name        string    // Name is the name of the key
+	Successes   int64     // Successes is the number of requests where GitHub accepted the JWT
+	Rejections  int64     // Rejections is the number of requests where GitHub rejected the JWT with 401 Unauthorized
+	LastSuccess time.Time // LastSuccess is when GitHub last accepted the JWT, or zero if it never has
+}
+
+// RotatingSigner signs JWT tokens with one of several keys, supporting GitHub
+// App key rotation, where both the old and new keys are valid until the old
+// key is deleted.
+//
+// Sign always uses the primary key, the first key. When used with an
+// AppsTransport, if GitHub rejects the JWT with 401 Unauthorized the request
+// is retried with each following key in order. Requests with a body can only
+// be retried if the request's GetBody is set, as it is for requests created by
+// http.NewRequest with a bytes.Buffer, bytes.Reader or strings.Reader body.
+//
+// RotatingSigner is safe to be used concurrently.
+type RotatingSigner struct {
+	keys []RotatingKey
+
+	mu    sync.Mutex // mu protects usage
+	usage []KeyUsage // usage is the usage of each key, in the same order as keys
+}
+
+var _ Signer = &RotatingSigner{}
+
+// NewRotatingSigner returns a RotatingSigner using keys, where the first key is
+// the primary key.
+func NewRotatingSigner(keys ...RotatingKey) (*RotatingSigner, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no keys provided")
+	}
+	s := &RotatingSigner{
+		keys:  append([]RotatingKey(nil), keys...),
+		usage: make([]KeyUsage, len(keys)),
+	}
+	for i, key := range keys {
+		if key.Signer == nil {
+			return nil, fmt.Errorf("key %d %q has no signer", i, key.Name)
+		}
+		s.usage[i].Name = key.Name
+	}
+	return s, nil
+}
+
+// Sign signs the JWT claims with the primary key.
+func (s *RotatingSigner) Sign(claims jwt.Claims) (string, error) {
+	return s.signWith(0, claims)
+}
+
+// Usage returns the usage of each key, in the order the keys were provided.
+func (s *RotatingSigner) Usage() []KeyUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]KeyUsage(nil), s.usage...)
+}
+
+// signWith signs the JWT claims with the i-th key.
+func (s *RotatingSigner) signWith(i int, claims jwt.Claims) (string, error) {
+	ss, err := s.keys[i].Signer.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("key %q: %w", s.keys[i].Name, err)
+	}
+	return ss, nil
+}
+
+// record records whether GitHub accepted a JWT signed with the i-th key.
+func (s *RotatingSigner) record(i int, accepted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if accepted {
+		s.usage[i].Successes++
+		s.usage[i].LastSuccess = time.Now()
+	} else {
+		s.usage[i].Rejections++
+	}
+}
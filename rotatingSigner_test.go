@@ -0,0 +1,133 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+func TestRotatingSignerFallback(t *testing.T) {
+	registeredKey, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unregisteredKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewRotatingSigner(
+		RotatingKey{Name: "new", Signer: NewRSASigner(jwt.SigningMethodRS256, unregisteredKey)},
+		RotatingKey{Name: "old", Signer: NewRSASigner(jwt.SigningMethodRS256, registeredKey)},
+	)
+	if err != nil {
+		t.Fatalf("NewRotatingSigner: %v", err)
+	}
+
+	var bodies []string
+	check := RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(req.Body)
+			req.Body.Close()
+			bodies = append(bodies, string(body))
+
+			status := http.StatusOK
+			ss := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if _, err := jwt.Parse(ss, func(*jwt.Token) (interface{}, error) { return &registeredKey.PublicKey, nil }); err != nil {
+				status = http.StatusUnauthorized
+			}
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(strings.NewReader("{}")),
+			}, nil
+		},
+	}
+
+	tr, err := NewAppsTransportWithOptions(check, appID, WithSigner(signer))
+	if err != nil {
+		t.Fatalf("NewAppsTransportWithOptions: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, "https://api.github.com/app/installations/1/access_tokens", bytes.NewBufferString("body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("error calling RoundTrip: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("status got: %d want: %d", resp.StatusCode, http.StatusOK)
+		}
+	}
+
+	for _, body := range bodies {
+		if body != "body" {
+			t.Errorf("request body got: %q want: %q", body, "body")
+		}
+	}
+
+	usage := signer.Usage()
+	if len(usage) != 2 {
+		t.Fatalf("usage got %d keys want 2", len(usage))
+	}
+	if u := usage[0]; u.Name != "new" || u.Successes != 0 || u.Rejections != 2 {
+		t.Errorf("primary key usage got: %+v", u)
+	}
+	if u := usage[1]; u.Name != "old" || u.Successes != 2 || u.Rejections != 0 || u.LastSuccess.IsZero() {
+		t.Errorf("fallback key usage got: %+v", u)
+	}
+}
+
+func TestRotatingSignerNoRetryWithoutGetBody(t *testing.T) {
+	signer, err := NewRotatingSigner(
+		RotatingKey{Name: "a", Signer: noopSigner{}},
+		RotatingKey{Name: "b", Signer: noopSigner{}},
+	)
+	if err != nil {
+		t.Fatalf("NewRotatingSigner: %v", err)
+	}
+
+	var requests int
+	check := RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			requests++
+			return &http.Response{
+				StatusCode: http.StatusUnauthorized,
+				Body:       io.NopCloser(strings.NewReader("{}")),
+			}, nil
+		},
+	}
+	tr, err := NewAppsTransportWithOptions(check, appID, WithSigner(signer))
+	if err != nil {
+		t.Fatalf("NewAppsTransportWithOptions: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.github.com/", io.NopCloser(strings.NewReader("body")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("error calling RoundTrip: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized || requests != 1 {
+		t.Errorf("got status %d after %d requests, want 401 after 1 request", resp.StatusCode, requests)
+	}
+}
+
+func TestNewRotatingSignerErrors(t *testing.T) {
+	if _, err := NewRotatingSigner(); err == nil {
+		t.Error("expected error with no keys")
+	}
+	if _, err := NewRotatingSigner(RotatingKey{Name: "a"}); err == nil {
+		t.Error("expected error with nil signer")
+	}
+}
@@ -0,0 +1,80 @@
+package ghinstallation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// redacted replaces secrets when formatted.
+const redacted = "[REDACTED]"
+
+// Secret is a credential, such as an access token or JWT, which is redacted
+// when formatted, marshalled as JSON or logged, preventing it from leaking
+// into logs. Reveal returns the credential itself.
+type Secret string
+
+var (
+	_ fmt.Stringer   = Secret("")
+	_ fmt.GoStringer = Secret("")
+	_ fmt.Formatter  = Secret("")
+	_ json.Marshaler = Secret("")
+	_ slog.LogValuer = Secret("")
+)
+
+// Reveal returns the secret's value.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String returns a redacted representation of the secret, or an empty string
+// if the secret is empty.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString implements fmt.GoStringer, returning a redacted representation of
+// the secret.
+func (s Secret) GoString() string {
+	return fmt.Sprintf("ghinstallation.Secret(%q)", s.String())
+}
+
+// Format implements fmt.Formatter, such that the secret is redacted for all
+// verbs.
+func (s Secret) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('#'):
+		_, _ = io.WriteString(f, s.GoString())
+	case verb == 'q':
+		_, _ = fmt.Fprintf(f, "%q", s.String())
+	default:
+		_, _ = io.WriteString(f, s.String())
+	}
+}
+
+// MarshalJSON implements json.Marshaler, marshalling the redacted secret.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// LogValue implements slog.LogValuer, logging the redacted secret.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// redactResponse returns a copy of resp whose request has its Authorization
+// header redacted, such that it is safe to return in errors.
+func redactResponse(resp *http.Response) *http.Response {
+	if resp == nil || resp.Request == nil || resp.Request.Header.Get("Authorization") == "" {
+		return resp
+	}
+	r := *resp
+	r.Request = cloneRequest(resp.Request)
+	r.Request.Header.Set("Authorization", redacted)
+	return &r
+}
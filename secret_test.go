@@ -0,0 +1,83 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSecretRedacted(t *testing.T) {
+	s := Secret(token)
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x", "%d"} {
+		if got := fmt.Sprintf(format, s); strings.Contains(got, token) {
+			t.Errorf("fmt.Sprintf(%q) revealed secret: %s", format, got)
+		}
+	}
+
+	js, err := json.Marshal(struct{ Token Secret }{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Token":"[REDACTED]"}`; string(js) != want {
+		t.Errorf("json.Marshal got: %s want: %s", js, want)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("token", "token", s)
+	if strings.Contains(buf.String(), token) {
+		t.Errorf("slog revealed secret: %s", buf.String())
+	}
+
+	if s.Reveal() != token {
+		t.Errorf("Reveal got: %q want: %q", s.Reveal(), token)
+	}
+	if Secret("").String() != "" {
+		t.Errorf("empty secret String got: %q want: %q", Secret("").String(), "")
+	}
+}
+
+func TestHTTPErrorRedacted(t *testing.T) {
+	var jwt string
+	tr, err := New(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		jwt = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		return &http.Response{
+			Status:     "401 Unauthorized",
+			StatusCode: http.StatusUnauthorized,
+			Body:       io.NopCloser(strings.NewReader(`{"message":"Bad credentials"}`)),
+			Request:    req,
+		}, nil
+	}), appID, installationID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	_, err = tr.SecretToken(t.Context())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected HTTPError, got: %v", err)
+	}
+	if jwt == "" {
+		t.Fatal("no JWT sent")
+	}
+
+	if auth := httpErr.Response.Request.Header.Get("Authorization"); strings.Contains(auth, jwt) {
+		t.Errorf("HTTPError response request revealed JWT: %q", auth)
+	}
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		if got := fmt.Sprintf(format, httpErr); strings.Contains(got, jwt) {
+			t.Errorf("fmt.Sprintf(%q) revealed JWT: %s", format, got)
+		}
+	}
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Error("refresh failed", "err", httpErr)
+	if strings.Contains(buf.String(), jwt) {
+		t.Errorf("slog revealed JWT: %s", buf.String())
+	}
+}
@@ -1,7 +1,14 @@
 package ghinstallation
 
 import (
+	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
 
 	jwt "github.com/golang-jwt/jwt/v4"
 )
@@ -31,3 +38,61 @@ func NewRSASigner(method *jwt.SigningMethodRSA, key *rsa.PrivateKey) *RSASigner
 func (s *RSASigner) Sign(claims jwt.Claims) (string, error) {
 	return jwt.NewWithClaims(s.method, claims).SignedString(s.key)
 }
+
+// Fingerprint returns the SHA-256 fingerprint of the RSA key, see
+// KeyFingerprint.
+func (s *RSASigner) Fingerprint() (string, error) {
+	return KeyFingerprint(&s.key.PublicKey)
+}
+
+// KeyFingerprint returns the SHA-256 fingerprint of an app's private key from
+// its public key, in the format shown in the GitHub App's settings, such as
+// "SHA256:aBc...=". This identifies which of the app's keys is in use.
+//
+// See https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/managing-private-keys-for-github-apps#verifying-private-keys
+func KeyFingerprint(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// CryptoSigner signs JWT tokens using RS256 with a [crypto.Signer], such as a
+// key held by a cloud KMS or hardware security module.
+type CryptoSigner struct {
+	signer crypto.Signer
+}
+
+// NewCryptoSigner returns a CryptoSigner using signer, whose public key must be
+// an RSA key.
+func NewCryptoSigner(signer crypto.Signer) (*CryptoSigner, error) {
+	if signer == nil {
+		return nil, errors.New("no crypto.Signer provided")
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported public key type %T, GitHub Apps require an RSA key", signer.Public())
+	}
+	return &CryptoSigner{signer: signer}, nil
+}
+
+// Sign signs the JWT claims using RS256 with the crypto.Signer.
+func (s *CryptoSigner) Sign(claims jwt.Claims) (string, error) {
+	ss, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SigningString()
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(ss))
+	sig, err := s.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("could not sign with crypto.Signer: %w", err)
+	}
+	return ss + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the crypto.Signer's key, see
+// KeyFingerprint.
+func (s *CryptoSigner) Fingerprint() (string, error) {
+	return KeyFingerprint(s.signer.Public().(*rsa.PublicKey))
+}
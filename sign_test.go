@@ -0,0 +1,107 @@
+package ghinstallation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+func TestCryptoSigner(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewCryptoSigner(key)
+	if err != nil {
+		t.Fatalf("NewCryptoSigner: %v", err)
+	}
+
+	iss := time.Now().Truncate(time.Second)
+	claims := &jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(iss),
+		ExpiresAt: jwt.NewNumericDate(iss.Add(time.Minute)),
+		Issuer:    "2",
+	}
+	got, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// RSASSA-PKCS1-v1_5 signatures are deterministic, so both signers must
+	// produce the same token.
+	want, err := NewRSASigner(jwt.SigningMethodRS256, key).Sign(claims)
+	if err != nil {
+		t.Fatalf("RSASigner.Sign: %v", err)
+	}
+	if got != want {
+		t.Errorf("CryptoSigner.Sign got: %q want: %q", got, want)
+	}
+}
+
+func TestNewCryptoSignerRejectsNonRSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewCryptoSigner(key)
+	if err == nil || !strings.Contains(err.Error(), "*ecdsa.PublicKey") {
+		t.Errorf("NewCryptoSigner error got: %v want unsupported key type error", err)
+	}
+}
+
+type failingSigner struct {
+	crypto.Signer
+}
+
+func (failingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("kms unavailable")
+}
+
+func TestCryptoSignerError(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewCryptoSigner(failingSigner{key})
+	if err != nil {
+		t.Fatalf("NewCryptoSigner: %v", err)
+	}
+	if _, err := signer.Sign(&jwt.RegisteredClaims{}); err == nil || !strings.Contains(err.Error(), "kms unavailable") {
+		t.Errorf("Sign error got: %v want: kms unavailable", err)
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// openssl rsa -in key.pem -pubout -outform DER | openssl sha256 -binary | openssl base64
+	const want = "SHA256:XDtqicx7/drP2IQJyaKjYih9TMRL7eEcDuq6+HetNlA="
+
+	got, err := NewRSASigner(jwt.SigningMethodRS256, key).Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint: %v", err)
+	}
+	if got != want {
+		t.Errorf("RSASigner.Fingerprint got: %q want: %q", got, want)
+	}
+
+	signer, err := NewCryptoSigner(key)
+	if err != nil {
+		t.Fatalf("NewCryptoSigner: %v", err)
+	}
+	if got, err := signer.Fingerprint(); err != nil || got != want {
+		t.Errorf("CryptoSigner.Fingerprint got: %q, %v want: %q", got, err, want)
+	}
+}
@@ -0,0 +1,233 @@
+// Package signertest implements support for testing implementations of
+// ghinstallation.Signer.
+package signertest
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// concurrency is the number of goroutines signing concurrently.
+const concurrency = 16
+
+// TestSigner tests a Signer, checking that it produces JWTs accepted by
+// GitHub in the same way as ghinstallation.RSASigner:
+//
+//   - the header's alg is RS256
+//   - the iat and exp claims are integers, and all claims are signed as given
+//   - the signature verifies with pub
+//   - concurrent calls to Sign are safe and return JWTs for their own claims
+//   - errors, such as claims that cannot be marshalled, are returned rather
+//     than a token or a panic
+//
+// The iss claim is issuer, which should be the app ID for signers that only
+// sign JWTs for a single app. Signers which cache JWTs, such as
+// ghinstallation.ExecSigner, do not sign all claims as given, and should be
+// tested with WithCaching.
+//
+// TestSigner returns an error describing all problems found. It is intended
+// to be called from a test:
+//
+//	if err := signertest.TestSigner(signer, &key.PublicKey, "1"); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// Run tests with the race detector to detect data races in Sign.
+func TestSigner(signer ghinstallation.Signer, pub *rsa.PublicKey, issuer string, opts ...Option) error {
+	if signer == nil || pub == nil {
+		return errors.New("signertest: signer and public key are required")
+	}
+	t := &tester{signer: signer, pub: pub, issuer: issuer}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.testToken()
+	t.testConcurrency()
+	t.testErrors()
+	return errors.Join(t.errs...)
+}
+
+// Option configures TestSigner.
+type Option func(*tester)
+
+// WithCaching tests a signer which may return a cached JWT signed for earlier
+// claims with the same issuer. Rather than checking all claims are signed as
+// given, TestSigner only checks the iss claim, the signature, and that the
+// iat and exp claims are integers and the JWT has not expired.
+func WithCaching() Option {
+	return func(t *tester) {
+		t.caching = true
+	}
+}
+
+// tester accumulates the problems found testing a signer.
+type tester struct {
+	signer  ghinstallation.Signer
+	pub     *rsa.PublicKey
+	issuer  string
+	caching bool // caching is whether the signer may return JWTs signed for earlier claims
+
+	mu   sync.Mutex
+	errs []error
+}
+
+func (t *tester) errorf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errs = append(t.errs, fmt.Errorf(format, args...))
+}
+
+// claims returns claims as used by ghinstallation.AppsTransport, with jti set
+// to id to distinguish them.
+func (t *tester) claims(id string) *jwt.RegisteredClaims {
+	iat := time.Now().Add(-30 * time.Second).Truncate(time.Second)
+	return &jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(iat),
+		ExpiresAt: jwt.NewNumericDate(iat.Add(2 * time.Minute)),
+		Issuer:    t.issuer,
+		ID:        id,
+	}
+}
+
+// testToken checks the header, claims and signature of a JWT.
+func (t *tester) testToken() {
+	claims := t.claims("signertest")
+	ss, err := t.signer.Sign(claims)
+	if err != nil {
+		t.errorf("Sign: %v", err)
+		return
+	}
+	parts := strings.Split(ss, ".")
+	if len(parts) != 3 {
+		t.errorf("Sign returned %d JWT segments, expected 3", len(parts))
+		return
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		t.errorf("could not decode JWT header: %v", err)
+	} else {
+		if header.Alg != "RS256" {
+			t.errorf("JWT header alg is %q, expected RS256", header.Alg)
+		}
+		if header.Typ != "" && header.Typ != "JWT" {
+			t.errorf("JWT header typ is %q, expected JWT", header.Typ)
+		}
+	}
+
+	var payload map[string]json.RawMessage
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		t.errorf("could not decode JWT claims: %v", err)
+	} else {
+		t.checkNumericClaim(payload, "iat", claims.IssuedAt)
+		t.checkNumericClaim(payload, "exp", claims.ExpiresAt)
+	}
+
+	t.verify(ss, claims)
+}
+
+// checkNumericClaim checks the claim name is an integer equal to want, as
+// GitHub rejects fractional timestamps.
+func (t *tester) checkNumericClaim(payload map[string]json.RawMessage, name string, want *jwt.NumericDate) {
+	got, ok := payload[name]
+	if !ok {
+		t.errorf("JWT claim %s is missing", name)
+		return
+	}
+	n, err := strconv.ParseInt(string(got), 10, 64)
+	if err != nil {
+		t.errorf("JWT claim %s is %s, expected an integer", name, got)
+		return
+	}
+	switch {
+	case t.caching && name == "exp" && n <= time.Now().Unix():
+		t.errorf("JWT claim exp is %d, which has expired", n)
+	case !t.caching && n != want.Unix():
+		t.errorf("JWT claim %s is %d, expected %d", name, n, want.Unix())
+	}
+}
+
+// verify checks the signature of ss and that it contains the claims.
+func (t *tester) verify(ss string, want *jwt.RegisteredClaims) {
+	var got jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(ss, &got, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return t.pub, nil
+	})
+	if err != nil {
+		t.errorf("could not verify JWT with public key: %v", err)
+		return
+	}
+	if got.Issuer != want.Issuer {
+		t.errorf("JWT claim iss is %q, expected %q", got.Issuer, want.Issuer)
+	}
+	if !t.caching && got.ID != want.ID {
+		t.errorf("JWT claim jti is %q, expected %q", got.ID, want.ID)
+	}
+}
+
+// testConcurrency checks concurrent calls to Sign sign their own claims.
+func (t *tester) testConcurrency() {
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			claims := t.claims(id)
+			ss, err := t.signer.Sign(claims)
+			if err != nil {
+				t.errorf("concurrent Sign: %v", err)
+				return
+			}
+			t.verify(ss, claims)
+		}(fmt.Sprintf("signertest-%d", i))
+	}
+	wg.Wait()
+}
+
+// unmarshalableClaims are claims which cannot be marshalled as JSON.
+type unmarshalableClaims struct {
+	jwt.RegisteredClaims
+	Invalid func() `json:"invalid"`
+}
+
+// testErrors checks errors are returned rather than a token or a panic.
+func (t *tester) testErrors() {
+	defer func() {
+		if r := recover(); r != nil {
+			t.errorf("Sign with claims that cannot be marshalled panicked: %v", r)
+		}
+	}()
+	claims := &unmarshalableClaims{RegisteredClaims: *t.claims("signertest"), Invalid: func() {}}
+	ss, err := t.signer.Sign(claims)
+	if err == nil {
+		t.errorf("Sign with claims that cannot be marshalled returned no error")
+	}
+	if ss != "" {
+		t.errorf("Sign with claims that cannot be marshalled returned a token with error %v", err)
+	}
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT into v.
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
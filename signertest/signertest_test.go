@@ -0,0 +1,164 @@
+package signertest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	appID = 2
+
+	// execSignerKeyEnv is set to the path of the private key when the test
+	// binary is run as an ExecSigner's command.
+	execSignerKeyEnv = "SIGNERTEST_EXEC_SIGNER_KEY"
+)
+
+var (
+	keyOnce sync.Once
+	key     *rsa.PrivateKey
+)
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	keyOnce.Do(func() {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return key
+}
+
+// TestExecSignerHelperProcess is run as the ExecSigner's command by
+// TestSignerImplementations, signing with the key at execSignerKeyEnv.
+func TestExecSignerHelperProcess(t *testing.T) {
+	path := os.Getenv(execSignerKeyEnv)
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		os.Exit(2)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		os.Exit(2)
+	}
+	var req ghinstallation.SignRequest
+	var claims jwt.MapClaims
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil || json.Unmarshal(req.Claims, &claims) != nil {
+		os.Exit(2)
+	}
+	ss, err := ghinstallation.NewRSASigner(jwt.SigningMethodRS256, key).Sign(claims)
+	if err != nil {
+		os.Exit(3)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(ghinstallation.SignResponse{APIVersion: ghinstallation.SignAPIVersion, Token: ss})
+	os.Exit(0)
+}
+
+func TestSignerImplementations(t *testing.T) {
+	key := testKey(t)
+
+	cryptoSigner, err := ghinstallation.NewCryptoSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatingSigner, err := ghinstallation.NewRotatingSigner(ghinstallation.RotatingKey{
+		Name:   "primary",
+		Signer: ghinstallation.NewRSASigner(jwt.SigningMethodRS256, key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := ghinstallation.NewSigningHandler(ghinstallation.NewRSASigner(jwt.SigningMethodRS256, key), appID)
+	handler.BearerToken = "s3cret"
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	remoteSigner := ghinstallation.NewRemoteSigner(ts.URL)
+	remoteSigner.BearerToken = "s3cret"
+
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	execSigner := ghinstallation.NewExecSigner(os.Args[0], "-test.run=^TestExecSignerHelperProcess$")
+	execSigner.Env = []string{execSignerKeyEnv + "=" + keyFile}
+
+	for name, signer := range map[string]ghinstallation.Signer{
+		"RSASigner":      ghinstallation.NewRSASigner(jwt.SigningMethodRS256, key),
+		"CryptoSigner":   cryptoSigner,
+		"RotatingSigner": rotatingSigner,
+		"RemoteSigner":   remoteSigner,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := TestSigner(signer, &key.PublicKey, "2"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// ExecSigner caches JWTs, so fails without WithCaching.
+	t.Run("ExecSigner", func(t *testing.T) {
+		if err := TestSigner(execSigner, &key.PublicKey, "2", WithCaching()); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// brokenSigner signs with HS256 and ignores errors, sharing a token between
+// calls.
+type brokenSigner struct {
+	once  sync.Once
+	token string
+}
+
+func (s *brokenSigner) Sign(claims jwt.Claims) (string, error) {
+	s.once.Do(func() {
+		s.token, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	})
+	return s.token, nil
+}
+
+func TestSignerReportsProblems(t *testing.T) {
+	key := testKey(t)
+
+	err := TestSigner(&brokenSigner{}, &key.PublicKey, "2")
+	if err == nil {
+		t.Fatal("expected problems with broken signer")
+	}
+	for _, want := range []string{
+		"alg is \"HS256\", expected RS256",
+		"could not verify JWT with public key",
+		"claims that cannot be marshalled returned no error",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = TestSigner(ghinstallation.NewRSASigner(jwt.SigningMethodRS256, other), &key.PublicKey, "2")
+	if err == nil || !strings.Contains(err.Error(), "could not verify JWT with public key") {
+		t.Errorf("expected verification error for wrong key, got: %v", err)
+	}
+
+	if err := TestSigner(nil, nil, ""); err == nil || !strings.Contains(err.Error(), "required") {
+		t.Errorf("expected error for nil signer, got: %v", err)
+	}
+}
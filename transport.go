@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
@@ -19,6 +21,10 @@ import (
 const (
 	acceptHeader = "application/vnd.github.v3+json"
 	apiBaseURL   = "https://api.github.com"
+
+	// accountRetryInterval is how long a Transport waits to request the
+	// installation's account again after the request failed.
+	accountRetryInterval = time.Minute
 )
 
 // Transport provides a http.RoundTripper by wrapping an existing
@@ -36,12 +42,25 @@ type Transport struct {
 	appID                    int64                            // appID is the GitHub App's ID
 	installationID           int64                            // installationID is the GitHub App Installation ID
 	InstallationTokenOptions *github.InstallationTokenOptions // parameters restrict a token's access
+	ScopeToRepository        bool                             // ScopeToRepository authenticates requests to /repos/{owner}/{repo}/... with a token restricted to that repository
+	PermissionRecorder       *PermissionRecorder              // PermissionRecorder, if set, records the permissions required by each request
+	AllowedHosts             []string                         // AllowedHosts are hosts permitted to receive the installation token in addition to BaseURL's host and its uploads host
+	Clock                    Clock                            // Clock provides the current time to determine when tokens expire, defaults to the system clock
 	appsTransport            *AppsTransport
 
-	mu    *sync.Mutex  // mu protects token
-	token *accessToken // token is the installation's access token
+	mu           *sync.Mutex             // mu protects token, repoTokens, repoMisses, account and accountRetry
+	token        *accessToken            // token is the installation's access token
+	repoTokens   map[string]*accessToken // repoTokens are access tokens restricted to a single repository, keyed by lower case owner/repo
+	repoMisses   map[string]bool         // repoMisses are repositories not in the installation, keyed by lower case owner/repo
+	account      string                  // account is the login of the installation's account, or empty until known
+	accountRetry time.Time               // accountRetry is when the account may next be requested, after a request started or failed
 }
 
+// errRepositoryNotInstalled is returned when a token restricted to a
+// repository cannot be requested, as the repository is not in the
+// installation.
+var errRepositoryNotInstalled = errors.New("repository not in installation")
+
 // accessToken is an installation access token response from GitHub
 type accessToken struct {
 	Token        string                         `json:"token"`
@@ -52,7 +71,8 @@ type accessToken struct {
 
 // HTTPError represents a custom error for failing HTTP operations.
 // Example in our usecase: refresh access token operation.
-// It enables the caller to inspect the root cause and response.
+// It enables the caller to inspect the root cause and response. The
+// Authorization header of the response's request is redacted.
 type HTTPError struct {
 	Message        string
 	RootCause      error
@@ -69,6 +89,23 @@ func (e *HTTPError) Unwrap() error {
 	return e.RootCause
 }
 
+// LogValue implements slog.LogValuer. Only the message, installation ID and
+// response status are logged, never the request's headers.
+func (e *HTTPError) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("message", e.Message),
+		slog.Int64("installation_id", e.InstallationID),
+	}
+	if e.Response != nil {
+		attrs = append(attrs, slog.Int("status", e.Response.StatusCode))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// ErrHostNotAllowed is returned when a request is made to a host that is not
+// permitted to receive the installation token.
+var ErrHostNotAllowed = errors.New("host is not allowed to receive the installation token")
+
 var _ http.RoundTripper = &Transport{}
 
 // NewKeyFromFile returns a Transport using a private key from file.
@@ -111,6 +148,7 @@ func NewFromAppsTransport(atr *AppsTransport, installationID int64) *Transport {
 		tr:             atr.tr,
 		appID:          atr.appID,
 		installationID: installationID,
+		Clock:          atr.Clock,
 		appsTransport:  atr,
 		mu:             &sync.Mutex{},
 	}
@@ -127,7 +165,15 @@ func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}()
 	}
 
-	token, err := t.Token(req.Context())
+	if err := checkHost(t.BaseURL, t.AllowedHosts, req.URL); err != nil {
+		return nil, err
+	}
+
+	if t.PermissionRecorder != nil {
+		t.PermissionRecorder.Record(req.Method, apiPath(t.BaseURL, req.URL))
+	}
+
+	token, err := t.tokenForRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -147,8 +193,8 @@ func (at *accessToken) getRefreshTime() time.Time {
 	return at.ExpiresAt.Add(-time.Minute)
 }
 
-func (at *accessToken) isExpired() bool {
-	return at == nil || at.getRefreshTime().Before(time.Now())
+func (at *accessToken) isExpired(now time.Time) bool {
+	return at == nil || at.getRefreshTime().Before(now)
 }
 
 // Token checks the active token expiration and renews if necessary. Token returns
@@ -156,7 +202,7 @@ func (at *accessToken) isExpired() bool {
 func (t *Transport) Token(ctx context.Context) (string, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if t.token.isExpired() {
+	if t.token.isExpired(now(t.Clock)) {
 		// Token is not set or expired/nearly expired, so refresh
 		if err := t.refreshToken(ctx); err != nil {
 			return "", fmt.Errorf("could not refresh installation id %v's token: %w", t.installationID, err)
@@ -166,6 +212,123 @@ func (t *Transport) Token(ctx context.Context) (string, error) {
 	return t.token.Token, nil
 }
 
+// SecretToken is like Token, but returns the access token as a Secret, which
+// is redacted if logged or formatted.
+func (t *Transport) SecretToken(ctx context.Context) (Secret, error) {
+	token, err := t.Token(ctx)
+	return Secret(token), err
+}
+
+// tokenForRequest returns the access token used to authenticate req. If
+// ScopeToRepository is set and req targets a repository in the installation,
+// the token is restricted to that repository, otherwise the installation's
+// token is used, such as for public repositories of other accounts.
+func (t *Transport) tokenForRequest(req *http.Request) (string, error) {
+	if t.ScopeToRepository {
+		if owner, repo, ok := repositoryFromPath(apiPath(t.BaseURL, req.URL)); ok && t.ownsRepository(req.Context(), owner) {
+			if opts, ok := t.repositoryTokenOptions(repo); ok {
+				token, err := t.repositoryToken(req.Context(), owner, repo, opts)
+				if !errors.Is(err, errRepositoryNotInstalled) {
+					return token, err
+				}
+			}
+		}
+	}
+	return t.Token(req.Context())
+}
+
+// ownsRepository reports whether the installation's account may own
+// repositories of owner. Until the account is known, ownsRepository reports
+// true, and repositoryToken detects repositories not in the installation
+// instead. The account is requested without blocking other requests, and
+// requested again after accountRetryInterval if the request fails.
+func (t *Transport) ownsRepository(ctx context.Context, owner string) bool {
+	t.mu.Lock()
+	account := t.account
+	current := now(t.Clock)
+	lookup := account == "" && !current.Before(t.accountRetry)
+	if lookup {
+		// Other requests do not request the account while this one does.
+		t.accountRetry = current.Add(accountRetryInterval)
+	}
+	t.mu.Unlock()
+
+	if lookup {
+		var err error
+		if account, err = t.requestAccount(ctx); err == nil {
+			t.mu.Lock()
+			t.account = account
+			t.mu.Unlock()
+		}
+	}
+	return account == "" || strings.EqualFold(account, owner)
+}
+
+// repositoryTokenOptions returns the options used to request a token restricted
+// to repo. Tokens are never granted access beyond InstallationTokenOptions, so
+// ok is false if those options already restrict access to other repositories.
+func (t *Transport) repositoryTokenOptions(repo string) (opts *github.InstallationTokenOptions, ok bool) {
+	opts = &github.InstallationTokenOptions{Repositories: []string{repo}}
+	if t.InstallationTokenOptions == nil {
+		return opts, true
+	}
+	if len(t.InstallationTokenOptions.RepositoryIDs) > 0 {
+		// Repository IDs cannot be matched against the request path.
+		return nil, false
+	}
+	if len(t.InstallationTokenOptions.Repositories) > 0 && !containsFold(t.InstallationTokenOptions.Repositories, repo) {
+		return nil, false
+	}
+	opts.Permissions = t.InstallationTokenOptions.Permissions
+	return opts, true
+}
+
+// repositoryToken returns an access token restricted to the owner/repo
+// repository, renewing it if necessary.
+func (t *Transport) repositoryToken(ctx context.Context, owner, repo string, opts *github.InstallationTokenOptions) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := strings.ToLower(owner + "/" + repo)
+	if t.repoMisses[key] {
+		return "", errRepositoryNotInstalled
+	}
+	token := t.repoTokens[key]
+	if token.isExpired(now(t.Clock)) {
+		var err error
+		if token, err = t.requestToken(ctx, opts); err != nil {
+			var httpErr *HTTPError
+			if errors.As(err, &httpErr) && httpErr.Response != nil && httpErr.Response.StatusCode == http.StatusUnprocessableEntity {
+				// GitHub rejects repositories not in the installation, remember
+				// them so requests do not request a token each time.
+				if t.repoMisses == nil {
+					t.repoMisses = make(map[string]bool)
+				}
+				t.repoMisses[key] = true
+				return "", errRepositoryNotInstalled
+			}
+			return "", fmt.Errorf("could not refresh installation id %v's token for repository %s/%s: %w", t.installationID, owner, repo, err)
+		}
+		if t.repoTokens == nil {
+			t.repoTokens = make(map[string]*accessToken)
+		}
+		t.repoTokens[key] = token
+	}
+
+	return token.Token, nil
+}
+
+// Invalidate discards the transport's tokens, so new tokens are requested by
+// the next request. Use Invalidate when a token's permissions or repositories
+// are known to have changed, such as after an installation accepts new
+// permissions.
+func (t *Transport) Invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = nil
+	t.repoTokens = nil
+	t.repoMisses = nil
+}
+
 // Permissions returns a transport token's GitHub installation permissions.
 func (t *Transport) Permissions() (github.InstallationPermissions, error) {
 	if t.token == nil {
@@ -203,16 +366,56 @@ func (t *Transport) InstallationID() int64 {
 }
 
 func (t *Transport) refreshToken(ctx context.Context) error {
+	token, err := t.requestToken(ctx, t.InstallationTokenOptions)
+	if err != nil {
+		return err
+	}
+	t.token = token
+	return nil
+}
+
+// requestAccount requests the login of the installation's account from
+// GitHub.
+func (t *Transport) requestAccount(ctx context.Context) (string, error) {
+	requestURL := fmt.Sprintf("%s/app/installations/%v", strings.TrimRight(t.BaseURL, "/"), t.installationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not create request: %s", err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+
+	resp, err := t.appsTransport.RoundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("could not get installation ID %v: %w", t.installationID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("received non 2xx response status %q when fetching %v", resp.Status, req.URL)
+	}
+
+	var installation github.Installation
+	if err := json.NewDecoder(resp.Body).Decode(&installation); err != nil {
+		return "", fmt.Errorf("could not decode installation: %w", err)
+	}
+	if installation.GetAccount().GetLogin() == "" {
+		return "", fmt.Errorf("installation ID %v has no account", t.installationID)
+	}
+	return installation.GetAccount().GetLogin(), nil
+}
+
+// requestToken requests a new installation access token from GitHub, restricted
+// by opts.
+func (t *Transport) requestToken(ctx context.Context, opts *github.InstallationTokenOptions) (*accessToken, error) {
 	// Convert InstallationTokenOptions into a ReadWriter to pass as an argument to http.NewRequest.
-	body, err := GetReadWriter(t.InstallationTokenOptions)
+	body, err := GetReadWriter(opts)
 	if err != nil {
-		return fmt.Errorf("could not convert installation token parameters into json: %s", err)
+		return nil, fmt.Errorf("could not convert installation token parameters into json: %s", err)
 	}
 
 	requestURL := fmt.Sprintf("%s/app/installations/%v/access_tokens", strings.TrimRight(t.BaseURL, "/"), t.installationID)
 	req, err := http.NewRequest("POST", requestURL, body)
 	if err != nil {
-		return fmt.Errorf("could not create request: %s", err)
+		return nil, fmt.Errorf("could not create request: %s", err)
 	}
 
 	// Set Content and Accept headers.
@@ -225,27 +428,29 @@ func (t *Transport) refreshToken(ctx context.Context) error {
 		req = req.WithContext(ctx)
 	}
 
-	t.appsTransport.BaseURL = t.BaseURL
-	t.appsTransport.Client = t.Client
 	resp, err := t.appsTransport.RoundTrip(req)
 	e := &HTTPError{
 		RootCause:      err,
 		InstallationID: t.installationID,
-		Response:       resp,
+		Response:       redactResponse(resp),
 	}
 	if err != nil {
 		e.Message = fmt.Sprintf("could not get access_tokens from GitHub API for installation ID %v: %v", t.installationID, err)
-		return e
+		return nil, e
 	}
 
 	if resp.StatusCode/100 != 2 {
 		e.Message = fmt.Sprintf("received non 2xx response status %q when fetching %v", resp.Status, req.URL)
-		return e
+		return nil, e
 	}
 	// Closing body late, to provide caller a chance to inspect body in an error / non-200 response status situation
 	defer resp.Body.Close()
 
-	return json.NewDecoder(resp.Body).Decode(&t.token)
+	var token *accessToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	return token, nil
 }
 
 // GetReadWriter converts a body interface into an io.ReadWriter object.
@@ -262,6 +467,73 @@ func GetReadWriter(i interface{}) (io.ReadWriter, error) {
 	return buf, nil
 }
 
+// apiPath returns the path of u relative to baseURL's path, such that requests
+// to GitHub Enterprise Server's /api/v3 prefix match the same API routes as
+// requests to api.github.com.
+func apiPath(baseURL string, u *url.URL) string {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return u.Path
+	}
+	prefix := strings.TrimRight(base.Path, "/")
+	if prefix != "" && strings.HasPrefix(u.Path, prefix+"/") {
+		return strings.TrimPrefix(u.Path, prefix)
+	}
+	return u.Path
+}
+
+// allowedHosts returns the hosts permitted to receive credentials for the API
+// at baseURL, followed by extra.
+func allowedHosts(baseURL string, extra []string) []string {
+	var hosts []string
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		host := strings.ToLower(u.Host)
+		hosts = append(hosts, host)
+		// GitHub.com and GHE.com serve uploads from a sibling of the API host, such
+		// as uploads.github.com, while GitHub Enterprise Server uses the API host.
+		if domain, ok := strings.CutPrefix(host, "api."); ok {
+			hosts = append(hosts, "uploads."+domain)
+		}
+	}
+	return append(hosts, extra...)
+}
+
+// checkHost returns an error wrapping ErrHostNotAllowed if u's host is not
+// permitted to receive credentials for the API at baseURL. Hosts without a port
+// match any port. No checks are made if baseURL is empty.
+func checkHost(baseURL string, extra []string, u *url.URL) error {
+	if baseURL == "" {
+		return nil
+	}
+	hosts := allowedHosts(baseURL, extra)
+	for _, host := range hosts {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q is not one of %s", ErrHostNotAllowed, u.Host, strings.Join(hosts, ", "))
+}
+
+// repositoryFromPath returns the repository targeted by an API path of the
+// form /repos/{owner}/{repo}/...
+func repositoryFromPath(path string) (owner, repo string, ok bool) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 4)
+	if len(parts) < 3 || parts[0] != "repos" || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// containsFold reports whether s is in list, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
 // cloneRequest returns a clone of the provided *http.Request.
 // The clone is a shallow copy of the struct and its Header map.
 func cloneRequest(r *http.Request) *http.Request {
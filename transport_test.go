@@ -2,6 +2,7 @@ package ghinstallation
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -480,3 +481,294 @@ func TestHTTPErrorUnwrap(t *testing.T) {
 		t.Errorf("HTTPError should be unwrapped to the root cause")
 	}
 }
+
+func TestScopeToRepository(t *testing.T) {
+	// The installation token is restricted by InstallationTokenOptions to both
+	// repositories, scoped tokens to a single repository.
+	const installationToken = "scoped-repo,unused"
+	var minted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/api/v3/app/installations/%d/access_tokens", installationID):
+			var opts github.InstallationTokenOptions
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+				t.Fatalf("could not decode installation token options: %v", err)
+			}
+			tok := "scoped-" + strings.Join(opts.Repositories, ",")
+			if opts.Permissions == nil || opts.Permissions.GetIssues() != "read" {
+				t.Errorf("installation token options permissions got: %+v want issues: read", opts.Permissions)
+			}
+			minted = append(minted, tok)
+			js, _ := json.Marshal(accessToken{
+				Token:     tok,
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			fmt.Fprintln(w, string(js))
+		case fmt.Sprintf("/api/v3/app/installations/%d", installationID):
+			fmt.Fprint(w, `{"id":1,"account":{"login":"owner"}}`)
+		case "/api/v3/repos/owner/Repo/issues", "/api/v3/repos/OWNER/repo/pulls":
+			if want := "token scoped-Repo"; r.Header.Get("Authorization") != want {
+				t.Errorf("%s Authorization got: %q want: %q", r.URL.Path, r.Header.Get("Authorization"), want)
+			}
+		case "/api/v3/repos/owner/other", "/api/v3/user":
+			if want := "token " + installationToken; r.Header.Get("Authorization") != want {
+				t.Errorf("%s Authorization got: %q want: %q", r.URL.Path, r.Header.Get("Authorization"), want)
+			}
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	tr, err := New(&http.Transport{}, appID, installationID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	tr.BaseURL = ts.URL + "/api/v3"
+	tr.ScopeToRepository = true
+	tr.InstallationTokenOptions = &github.InstallationTokenOptions{
+		Repositories: []string{"repo", "unused"},
+		Permissions: &github.InstallationPermissions{
+			Issues: github.Ptr("read"),
+		},
+	}
+
+	client := http.Client{Transport: tr}
+	for _, path := range []string{"/repos/owner/Repo/issues", "/repos/OWNER/repo/pulls", "/user", "/repos/owner/other"} {
+		resp, err := client.Get(tr.BaseURL + path)
+		if err != nil {
+			t.Fatalf("unexpected error from client for %s: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+
+	if diff := cmp.Diff([]string{"scoped-Repo", installationToken}, minted); diff != "" {
+		t.Errorf("minted tokens want->got: %s", diff)
+	}
+}
+
+func TestScopeToRepositoryNotInstalled(t *testing.T) {
+	var minted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/app/installations/%d", installationID):
+			fmt.Fprint(w, `{"id":1,"account":{"login":"owner"}}`)
+		case fmt.Sprintf("/app/installations/%d/access_tokens", installationID):
+			var opts github.InstallationTokenOptions
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+				t.Fatalf("could not decode installation token options: %v", err)
+			}
+			minted = append(minted, strings.Join(opts.Repositories, ","))
+			if len(opts.Repositories) > 0 && opts.Repositories[0] == "missing" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, `{"message":"There is at least one repository that does not exist or is not accessible to the parent installation."}`)
+				return
+			}
+			js, _ := json.Marshal(accessToken{Token: "installation", ExpiresAt: time.Now().Add(time.Hour)})
+			fmt.Fprintln(w, string(js))
+		case "/repos/golang/go", "/repos/owner/missing":
+			if want := "token installation"; r.Header.Get("Authorization") != want {
+				t.Errorf("%s Authorization got: %q want: %q", r.URL.Path, r.Header.Get("Authorization"), want)
+			}
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	tr, err := New(&http.Transport{}, appID, installationID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	tr.BaseURL = ts.URL
+	tr.ScopeToRepository = true
+
+	client := http.Client{Transport: tr}
+	get := func(path string) {
+		t.Helper()
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error from client for %s: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+	// Public repositories of other accounts use the installation token.
+	get("/repos/golang/go")
+	// Repositories of the account not in the installation fall back to the
+	// installation token, and are not requested again.
+	get("/repos/owner/missing")
+	get("/repos/owner/missing")
+	if diff := cmp.Diff([]string{"", "missing"}, minted); diff != "" {
+		t.Errorf("minted tokens want->got: %s", diff)
+	}
+
+	// The repository may since have been added to the installation.
+	tr.Invalidate()
+	get("/repos/owner/missing")
+	if diff := cmp.Diff([]string{"", "missing", "missing", ""}, minted); diff != "" {
+		t.Errorf("minted tokens after Invalidate want->got: %s", diff)
+	}
+}
+
+func TestScopeToRepositoryAccountRetry(t *testing.T) {
+	var lookups int
+	var minted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/app/installations/%d", installationID):
+			lookups++
+			if lookups == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			fmt.Fprint(w, `{"id":1,"account":{"login":"owner"}}`)
+		case fmt.Sprintf("/app/installations/%d/access_tokens", installationID):
+			var opts github.InstallationTokenOptions
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+				t.Fatalf("could not decode installation token options: %v", err)
+			}
+			minted = append(minted, strings.Join(opts.Repositories, ","))
+			if len(opts.Repositories) > 0 {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			js, _ := json.Marshal(accessToken{Token: "installation", ExpiresAt: time.Now().Add(time.Hour)})
+			fmt.Fprintln(w, string(js))
+		}
+	}))
+	defer ts.Close()
+
+	tr, err := New(&http.Transport{}, appID, installationID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	clock := &fakeClock{now: time.Now()}
+	tr.BaseURL = ts.URL
+	tr.ScopeToRepository = true
+	tr.Clock = clock
+
+	client := http.Client{Transport: tr}
+	get := func(path string) {
+		t.Helper()
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error from client for %s: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+	// The account is unknown after the failed request, so repositories are
+	// checked by requesting a token, and the account is not requested again
+	// until the retry interval has passed.
+	get("/repos/golang/go")
+	get("/repos/golang/tools")
+	clock.Advance(accountRetryInterval)
+	get("/repos/golang/net")
+	get("/repos/golang/text")
+	if lookups != 2 {
+		t.Errorf("account lookups got: %d want: 2", lookups)
+	}
+	if diff := cmp.Diff([]string{"go", "", "tools"}, minted); diff != "" {
+		t.Errorf("minted tokens want->got: %s", diff)
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	var hosts []string
+	tr := &Transport{
+		BaseURL:      apiBaseURL,
+		AllowedHosts: []string{"objects.example.com"},
+		token: &accessToken{
+			ExpiresAt: time.Now().Add(1 * time.Hour),
+			Token:     token,
+		},
+		mu: &sync.Mutex{},
+		tr: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			hosts = append(hosts, req.URL.Host)
+			return nil, nil
+		}),
+	}
+
+	for _, tc := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://api.github.com/repos/o/r", true},
+		{"https://API.github.com:443/repos/o/r", true},
+		{"https://uploads.github.com/repos/o/r/releases/1/assets", true},
+		{"https://objects.example.com/file", true},
+		{"https://codeload.github.com/o/r/zip/main", false},
+		{"https://api.github.com.example.com/", false},
+	} {
+		req, err := http.NewRequest("GET", tc.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts = nil
+		_, err = tr.RoundTrip(req)
+		if tc.allowed {
+			if err != nil {
+				t.Errorf("RoundTrip(%q) unexpected error: %v", tc.url, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("RoundTrip(%q) error got: %v want: %v", tc.url, err, ErrHostNotAllowed)
+		}
+		if len(hosts) > 0 {
+			t.Errorf("RoundTrip(%q) sent request to disallowed host", tc.url)
+		}
+	}
+}
+
+// fakeClock is a Clock whose time only changes when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestClockRefresh(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var refreshes int
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		refreshes++
+		js, _ := json.Marshal(accessToken{
+			Token:     fmt.Sprintf("token-%d", refreshes),
+			ExpiresAt: clock.Now().Add(time.Hour),
+		})
+		return &http.Response{StatusCode: http.StatusCreated, Body: io.NopCloser(bytes.NewReader(js))}, nil
+	})
+	tr := NewFromAppsTransport(&AppsTransport{tr: rt, signer: noopSigner{}, Clock: clock}, installationID)
+
+	for _, tc := range []struct {
+		advance time.Duration
+		want    string
+	}{
+		{0, "token-1"},
+		{58 * time.Minute, "token-1"}, // 2 minutes before expiry
+		{59 * time.Second, "token-1"}, // 1 second before the refresh margin
+		{2 * time.Second, "token-2"},  // inside the refresh margin
+		{time.Hour, "token-3"},        // expired
+		{30 * time.Minute, "token-3"}, // valid
+	} {
+		clock.Advance(tc.advance)
+		got, err := tr.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("at %v token got: %q want: %q", clock.Now().Format(time.TimeOnly), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrRefreshTokenExpired is returned when a user access token has expired and
+// cannot be renewed, as its refresh token is missing or has expired. The user
+// must authorize the app again.
+var ErrRefreshTokenExpired = errors.New("user access token expired and cannot be refreshed")
+
+// UserTransport provides a http.RoundTripper by wrapping an existing
+// http.RoundTripper and provides GitHub Apps authentication as a user, using
+// an OAuth user access token.
+//
+// Expiring user access tokens are renewed using the refresh token shortly
+// before they expire. Refresh tokens are single use, so each renewal returns a
+// new refresh token which is passed to OnRefresh to be persisted.
+//
+// See https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/refreshing-user-access-tokens
+type UserTransport struct {
+	BaseURL      string                // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
+	WebURL       string                // WebURL is the scheme and host of GitHub's OAuth endpoints, defaults to https://github.com
+	Client       Client                // Client to use to refresh tokens, defaults to http.Client with provided transport
+	ClientID     string                // ClientID is the GitHub App's client ID
+	ClientSecret Secret                // ClientSecret is the GitHub App's client secret, which may be empty for tokens from the device flow
+	OnRefresh    func(UserToken) error // OnRefresh, if set, is called with each renewed token, such as to persist the rotated refresh token, and retried until it succeeds
+	AllowedHosts []string              // AllowedHosts are hosts permitted to receive the user access token in addition to BaseURL's host and its uploads host
+	Clock        Clock                 // Clock provides the current time to determine when tokens expire, defaults to the system clock
+	tr           http.RoundTripper     // tr is the underlying roundtripper being wrapped
+
+	mu      *sync.Mutex // mu protects token and unsaved
+	token   *UserToken  // token is the user's access token
+	unsaved bool        // unsaved is whether token was renewed but OnRefresh has not yet succeeded
+}
+
+var _ http.RoundTripper = &UserTransport{}
+
+// NewUserTransport returns a UserTransport authenticating as the user with
+// token, renewing it using the GitHub App's clientID and clientSecret.
+//
+// The returned Transport's RoundTrip method is safe to be used concurrently.
+func NewUserTransport(tr http.RoundTripper, clientID string, clientSecret Secret, token UserToken) *UserTransport {
+	return &UserTransport{
+		BaseURL:      apiBaseURL,
+		WebURL:       webBaseURL,
+		Client:       &http.Client{Transport: tr},
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		tr:           tr,
+		mu:           &sync.Mutex{},
+		token:        &token,
+	}
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *UserTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBodyClosed := false
+	if req.Body != nil {
+		defer func() {
+			if !reqBodyClosed {
+				req.Body.Close()
+			}
+		}()
+	}
+
+	if err := checkHost(t.BaseURL, t.AllowedHosts, req.URL); err != nil {
+		return nil, err
+	}
+
+	token, err := t.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	creq := cloneRequest(req) // per RoundTripper contract
+	creq.Header.Set("Authorization", "Bearer "+token)
+
+	if creq.Header.Get("Accept") == "" { // We only add an "Accept" header to avoid overwriting the expected behavior.
+		creq.Header.Add("Accept", acceptHeader)
+	}
+	reqBodyClosed = true // req.Body is assumed to be closed by the tr RoundTripper.
+	return t.tr.RoundTrip(creq)
+}
+
+// Token returns a valid user access token, renewing it if necessary. If
+// renewal fails an error is returned. Errors from OnRefresh are not returned,
+// as the token is valid, and OnRefresh is retried by later calls.
+func (t *UserTransport) Token(ctx context.Context) (string, error) {
+	token, _, err := t.userToken(ctx)
+	return token.AccessToken.Reveal(), err
+}
+
+// UserToken returns the current user token, renewing it if it expires soon or
+// has no access token. If the token was renewed but OnRefresh returned an
+// error, OnRefresh is called again, and if it fails the token is returned with
+// its error.
+func (t *UserTransport) UserToken(ctx context.Context) (UserToken, error) {
+	token, storeErr, err := t.userToken(ctx)
+	if err != nil {
+		return token, err
+	}
+	return token, storeErr
+}
+
+// userToken returns the current user token, renewing it if necessary, and the
+// error from OnRefresh if the renewed token could not be stored.
+func (t *UserTransport) userToken(ctx context.Context) (UserToken, error, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current := now(t.Clock)
+	// A token without an access token, such as one restored from a persisted
+	// refresh token, is renewed immediately.
+	if t.token.AccessToken != "" && (t.token.ExpiresAt.IsZero() || current.Before(t.token.ExpiresAt.Add(-time.Minute))) {
+		return *t.token, t.store(), nil
+	}
+
+	if t.token.RefreshToken == "" || (!t.token.RefreshTokenExpiresAt.IsZero() && !current.Before(t.token.RefreshTokenExpiresAt)) {
+		return UserToken{}, nil, ErrRefreshTokenExpired
+	}
+	form := url.Values{
+		"client_id":     {t.ClientID},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.token.RefreshToken.Reveal()},
+	}
+	if t.ClientSecret != "" {
+		form.Set("client_secret", t.ClientSecret.Reveal())
+	}
+	token, err := exchangeToken(ctx, t.Client, t.WebURL, form, current)
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == "bad_refresh_token" {
+			return UserToken{}, nil, fmt.Errorf("could not refresh user access token: %w: %w", ErrRefreshTokenExpired, err)
+		}
+		return UserToken{}, nil, fmt.Errorf("could not refresh user access token: %w", err)
+	}
+	// The previous refresh token is no longer valid, so the renewed token must
+	// be stored, even if OnRefresh fails now.
+	t.token = token
+	t.unsaved = t.OnRefresh != nil
+	return *token, t.store(), nil
+}
+
+// store passes the renewed token to OnRefresh, if it has not already been
+// stored.
+func (t *UserTransport) store() error {
+	if !t.unsaved {
+		return nil
+	}
+	if err := t.OnRefresh(*t.token); err != nil {
+		return fmt.Errorf("could not store refreshed user access token: %w", err)
+	}
+	t.unsaved = false
+	return nil
+}
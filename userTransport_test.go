@@ -0,0 +1,245 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserTransport(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var refreshes int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			wantRefresh := fmt.Sprintf("ghr_%d", refreshes)
+			if r.PostForm.Get("client_id") != "Iv1.abc" || r.PostForm.Get("client_secret") != "s3cret" ||
+				r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != wantRefresh {
+				t.Errorf("unexpected refresh request: %v", r.PostForm)
+			}
+			refreshes++
+			fmt.Fprintf(w, `{"access_token":"ghu_%d","expires_in":28800,"refresh_token":"ghr_%d","refresh_token_expires_in":15897600,"token_type":"bearer","scope":""}`, refreshes, refreshes)
+		case "/api/v3/user":
+			fmt.Fprint(w, r.Header.Get("Authorization"))
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	tr := NewUserTransport(http.DefaultTransport, "Iv1.abc", "s3cret", UserToken{
+		AccessToken:  "ghu_0",
+		ExpiresAt:    clock.Now().Add(8 * time.Hour),
+		RefreshToken: "ghr_0",
+	})
+	tr.BaseURL = ts.URL + "/api/v3"
+	tr.WebURL = ts.URL
+	tr.Clock = clock
+	var stored []string
+	tr.OnRefresh = func(token UserToken) error {
+		stored = append(stored, token.RefreshToken.Reveal())
+		return nil
+	}
+
+	get := func() string {
+		t.Helper()
+		resp, err := (&http.Client{Transport: tr}).Get(tr.BaseURL + "/user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := get(); got != "Bearer ghu_0" {
+		t.Errorf("Authorization got: %q want: %q", got, "Bearer ghu_0")
+	}
+	for _, tc := range []struct {
+		advance time.Duration
+		want    string
+	}{
+		{0, "ghu_0"},
+		{8*time.Hour - 2*time.Minute, "ghu_0"},
+		{time.Minute + time.Second, "ghu_1"},
+		{8 * time.Hour, "ghu_2"},
+	} {
+		clock.Advance(tc.advance)
+		got, err := tr.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("token got: %q want: %q", got, tc.want)
+		}
+	}
+	if want := []string{"ghr_1", "ghr_2"}; fmt.Sprint(stored) != fmt.Sprint(want) {
+		t.Errorf("stored refresh tokens got: %v want: %v", stored, want)
+	}
+}
+
+func TestUserTransportRefreshErrors(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":"bad_refresh_token","error_description":"The refresh token passed is incorrect or expired.","error_uri":"https://docs.github.com"}`)
+	}))
+	defer ts.Close()
+
+	expired := UserToken{AccessToken: "ghu_0", ExpiresAt: clock.Now().Add(-time.Hour), RefreshToken: "ghr_0"}
+	tr := NewUserTransport(http.DefaultTransport, "Iv1.abc", "s3cret", expired)
+	tr.WebURL = ts.URL
+	tr.Clock = clock
+
+	_, err := tr.Token(context.Background())
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "bad_refresh_token" {
+		t.Errorf("expected OAuthError bad_refresh_token, got: %v", err)
+	}
+	if !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("expected ErrRefreshTokenExpired, got: %v", err)
+	}
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Response.Request.GetBody != nil {
+		t.Errorf("expected HTTPError without request body, got: %v", err)
+	}
+
+	expired.RefreshTokenExpiresAt = clock.Now().Add(-time.Minute)
+	tr = NewUserTransport(http.DefaultTransport, "Iv1.abc", "s3cret", expired)
+	tr.WebURL = ts.URL
+	tr.Clock = clock
+	if _, err := tr.Token(context.Background()); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("expected ErrRefreshTokenExpired for expired refresh token, got: %v", err)
+	}
+
+	if _, err := tr.RoundTrip(httptest.NewRequest(http.MethodGet, "https://example.com/user", nil)); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected ErrHostNotAllowed, got: %v", err)
+	}
+}
+
+func TestUserTransportRefreshTokenOnly(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var refreshes int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			if r.PostForm.Get("refresh_token") != "ghr_stored" {
+				t.Errorf("unexpected refresh request: %v", r.PostForm)
+			}
+			refreshes++
+			fmt.Fprint(w, `{"access_token":"ghu_1","expires_in":28800,"refresh_token":"ghr_1","refresh_token_expires_in":15897600,"token_type":"bearer"}`)
+		case "/user":
+			fmt.Fprint(w, r.Header.Get("Authorization"))
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	// A service restarting with only its persisted refresh token.
+	tr := NewUserTransport(http.DefaultTransport, "Iv1.abc", "s3cret", UserToken{RefreshToken: "ghr_stored"})
+	tr.BaseURL = ts.URL
+	tr.WebURL = ts.URL
+	tr.Clock = clock
+
+	resp, err := (&http.Client{Transport: tr}).Get(ts.URL + "/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if got, want := string(body), "Bearer ghu_1"; got != want {
+		t.Errorf("Authorization got: %q want: %q", got, want)
+	}
+	if refreshes != 1 {
+		t.Errorf("refreshes got: %v want: 1", refreshes)
+	}
+
+	tr = NewUserTransport(http.DefaultTransport, "Iv1.abc", "s3cret", UserToken{})
+	tr.WebURL = ts.URL
+	if _, err := tr.Token(context.Background()); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("expected ErrRefreshTokenExpired for empty token, got: %v", err)
+	}
+}
+
+func TestUserTransportOnRefreshRetried(t *testing.T) {
+	var refreshes int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+		fmt.Fprint(w, `{"access_token":"ghu_1","expires_in":28800,"refresh_token":"ghr_1","refresh_token_expires_in":15897600,"token_type":"bearer"}`)
+	}))
+	defer ts.Close()
+
+	tr := NewUserTransport(http.DefaultTransport, "Iv1.abc", "s3cret", UserToken{RefreshToken: "ghr_0"})
+	tr.WebURL = ts.URL
+	storeErr := errors.New("db down")
+	var stored []string
+	tr.OnRefresh = func(token UserToken) error {
+		if storeErr != nil {
+			return storeErr
+		}
+		stored = append(stored, token.RefreshToken.Reveal())
+		return nil
+	}
+
+	// The token is valid, so Token succeeds even though it was not stored.
+	if token, err := tr.Token(context.Background()); err != nil || token != "ghu_1" {
+		t.Errorf("Token got: %q, %v want: %q, nil", token, err, "ghu_1")
+	}
+	if token, err := tr.UserToken(context.Background()); !errors.Is(err, storeErr) || token.AccessToken != "ghu_1" {
+		t.Errorf("UserToken got: %q, %v want: %q, %v", token.AccessToken.Reveal(), err, "ghu_1", storeErr)
+	}
+
+	storeErr = nil
+	for range 2 {
+		if _, err := tr.UserToken(context.Background()); err != nil {
+			t.Errorf("unexpected UserToken error: %v", err)
+		}
+	}
+	if want := []string{"ghr_1"}; fmt.Sprint(stored) != fmt.Sprint(want) {
+		t.Errorf("stored refresh tokens got: %v want: %v", stored, want)
+	}
+	if refreshes != 1 {
+		t.Errorf("refreshes got: %v want: 1", refreshes)
+	}
+}
+
+func TestUserTokenJSON(t *testing.T) {
+	token := UserToken{
+		AccessToken:           "ghu_abc",
+		ExpiresAt:             time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC),
+		RefreshToken:          "ghr_abc",
+		RefreshTokenExpiresAt: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got UserToken
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != token {
+		t.Errorf("round trip got: %#v want: %#v", got, token)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("refreshed", "token", token)
+	if strings.Contains(buf.String(), "ghu_abc") || strings.Contains(buf.String(), "ghr_abc") {
+		t.Errorf("logged token contains secrets: %s", buf.String())
+	}
+}
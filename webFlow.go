@@ -0,0 +1,207 @@
+package ghinstallation
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// webFlowCookie is the name of the cookie storing the state and PKCE code
+	// verifier between the login and callback handlers.
+	webFlowCookie = "ghinstallation_oauth"
+	// webFlowTTL is how long a user has to authorize the app after login.
+	webFlowTTL = 10 * time.Minute
+)
+
+// ErrInvalidState is returned by the web and manifest flow callbacks when the
+// state parameter does not match the state generated when starting the flow,
+// such as when the flow has expired or the callback was forged.
+var ErrInvalidState = errors.New("invalid OAuth state")
+
+// WebFlow authorizes a GitHub App to act as a user using the OAuth web
+// application flow, with PKCE. LoginHandler redirects the user to GitHub to
+// authorize the app, and GitHub redirects them back to CallbackHandler, which
+// exchanges the code for a UserToken and passes it to OnToken. The resulting
+// UserToken can be used with a UserTransport.
+//
+// The state and PKCE code verifier are stored in a short lived, HttpOnly and
+// Secure cookie between the two handlers, so the handlers must be served over
+// HTTPS, or from localhost during development.
+//
+// See https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-user-access-token-for-a-github-app
+type WebFlow struct {
+	ClientID     string                                               // ClientID is the GitHub App's client ID
+	ClientSecret Secret                                               // ClientSecret is the GitHub App's client secret
+	RedirectURL  string                                               // RedirectURL is the URL of CallbackHandler, which must match a callback URL of the GitHub App
+	WebURL       string                                               // WebURL is the scheme and host of GitHub's OAuth endpoints, defaults to https://github.com
+	Client       Client                                               // Client sends requests to GitHub, defaults to http.DefaultClient
+	Clock        Clock                                                // Clock provides the current time, defaults to the system clock
+	OnToken      func(http.ResponseWriter, *http.Request, *UserToken) // OnToken is called by CallbackHandler with the user's token, and responds to the user
+	OnError      func(http.ResponseWriter, *http.Request, error)      // OnError, if set, is called by CallbackHandler when authorization fails, defaults to responding with the error
+}
+
+// NewWebFlow returns a WebFlow for the GitHub App with clientID and
+// clientSecret, whose callback is served at redirectURL and calls onToken.
+func NewWebFlow(clientID string, clientSecret Secret, redirectURL string, onToken func(http.ResponseWriter, *http.Request, *UserToken)) *WebFlow {
+	return &WebFlow{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		WebURL:       webBaseURL,
+		Client:       http.DefaultClient,
+		OnToken:      onToken,
+	}
+}
+
+// LoginHandler returns an http.Handler which starts the web flow, redirecting
+// the user to GitHub to authorize the app.
+func (f *WebFlow) LoginHandler() http.Handler {
+	return http.HandlerFunc(f.login)
+}
+
+// CallbackHandler returns an http.Handler which completes the web flow when
+// GitHub redirects the user back to RedirectURL, exchanging the code for a
+// UserToken and calling OnToken.
+func (f *WebFlow) CallbackHandler() http.Handler {
+	return http.HandlerFunc(f.callback)
+}
+
+func (f *WebFlow) login(w http.ResponseWriter, r *http.Request) {
+	state, err := randomString()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	verifier, err := randomString()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, stateCookie(webFlowCookie, f.RedirectURL, state+"."+verifier, int(webFlowTTL/time.Second)))
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"client_id":             {f.ClientID},
+		"redirect_uri":          {f.RedirectURL},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, f.webURL()+"/login/oauth/authorize?"+query.Encode(), http.StatusFound)
+}
+
+func (f *WebFlow) callback(w http.ResponseWriter, r *http.Request) {
+	token, err := f.exchange(r)
+	// The state is single use, so remove it whether or not the flow succeeded.
+	http.SetCookie(w, stateCookie(webFlowCookie, f.RedirectURL, "", -1))
+	if err != nil {
+		if f.OnError != nil {
+			f.OnError(w, r, err)
+			return
+		}
+		status := http.StatusBadGateway
+		var oauthErr *OAuthError
+		if errors.Is(err, ErrInvalidState) || errors.As(err, &oauthErr) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	f.OnToken(w, r, token)
+}
+
+// exchange validates the callback request and exchanges its code for the
+// user's token.
+func (f *WebFlow) exchange(r *http.Request) (*UserToken, error) {
+	verifier, err := checkState(r, webFlowCookie)
+	if err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+	if code := query.Get("error"); code != "" {
+		return nil, &OAuthError{Code: code, Description: query.Get("error_description"), URI: query.Get("error_uri")}
+	}
+	if query.Get("code") == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "callback contains no code"}
+	}
+
+	form := url.Values{
+		"client_id":     {f.ClientID},
+		"client_secret": {f.ClientSecret.Reveal()},
+		"code":          {query.Get("code")},
+		"redirect_uri":  {f.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	token, err := exchangeToken(r.Context(), f.client(), f.WebURL, form, now(f.Clock))
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange code for user access token: %w", err)
+	}
+	return token, nil
+}
+
+// stateCookie returns the cookie storing the state of a flow, and any other
+// values, between the handler starting the flow and its callback at
+// redirectURL. The cookie expires after maxAge seconds, or is deleted if maxAge
+// is negative.
+func stateCookie(name, redirectURL, value string, maxAge int) *http.Cookie {
+	path := "/"
+	if u, err := url.Parse(redirectURL); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// checkState compares the state parameter of a callback request with the
+// state stored in the named cookie, in constant time, and returns the value
+// stored after the state.
+func checkState(r *http.Request, name string) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: no state cookie", ErrInvalidState)
+	}
+	state, value, ok := strings.Cut(cookie.Value, ".")
+	if !ok || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(r.URL.Query().Get("state"))) != 1 {
+		return "", ErrInvalidState
+	}
+	return value, nil
+}
+
+func (f *WebFlow) webURL() string {
+	if f.WebURL == "" {
+		return webBaseURL
+	}
+	return strings.TrimRight(f.WebURL, "/")
+}
+
+func (f *WebFlow) client() Client {
+	if f.Client == nil {
+		return http.DefaultClient
+	}
+	return f.Client
+}
+
+// randomString returns a random, URL safe string with 256 bits of entropy,
+// suitable as an OAuth state or PKCE code verifier.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
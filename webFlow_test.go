@@ -0,0 +1,107 @@
+package ghinstallation
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWebFlow(t *testing.T) {
+	var verifier string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login/oauth/access_token" {
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		want := url.Values{
+			"client_id":     {"Iv1.abc"},
+			"client_secret": {"secret"},
+			"code":          {"code"},
+			"redirect_uri":  {"https://example.com/oauth/callback"},
+			"code_verifier": {verifier},
+		}
+		if r.PostForm.Encode() != want.Encode() {
+			t.Errorf("form got: %v want: %v", r.PostForm, want)
+		}
+		fmt.Fprint(w, `{"access_token":"ghu_abc","expires_in":28800,"refresh_token":"ghr_abc","refresh_token_expires_in":15897600,"token_type":"bearer"}`)
+	}))
+	defer ts.Close()
+
+	var got *UserToken
+	flow := NewWebFlow("Iv1.abc", "secret", "https://example.com/oauth/callback", func(w http.ResponseWriter, r *http.Request, token *UserToken) {
+		got = token
+	})
+	flow.WebURL = ts.URL
+
+	login := httptest.NewRecorder()
+	flow.LoginHandler().ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/login", nil))
+	if login.Code != http.StatusFound {
+		t.Fatalf("login status got: %v want: %v", login.Code, http.StatusFound)
+	}
+	cookies := login.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteLaxMode || cookies[0].Path != "/oauth/callback" {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+	location, err := url.Parse(login.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Path != "/login/oauth/authorize" || location.Query().Get("client_id") != "Iv1.abc" || location.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("unexpected redirect: %v", location)
+	}
+	state := location.Query().Get("state")
+	_, verifier, _ = strings.Cut(cookies[0].Value, ".")
+	challenge := sha256.Sum256([]byte(verifier))
+	if want := base64.RawURLEncoding.EncodeToString(challenge[:]); location.Query().Get("code_challenge") != want {
+		t.Errorf("code_challenge got: %q want: %q", location.Query().Get("code_challenge"), want)
+	}
+
+	callback := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/oauth/callback?"+query, nil)
+		req.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		flow.CallbackHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := callback("code=code&state=forged"); rec.Code != http.StatusBadRequest {
+		t.Errorf("forged state status got: %v want: %v", rec.Code, http.StatusBadRequest)
+	}
+	if rec := callback("error=access_denied&state=" + state); rec.Code != http.StatusBadRequest {
+		t.Errorf("access_denied status got: %v want: %v", rec.Code, http.StatusBadRequest)
+	}
+	if got != nil {
+		t.Fatalf("OnToken called on error with: %v", got)
+	}
+
+	rec := callback("code=code&state=" + state)
+	if rec.Code != http.StatusOK {
+		t.Errorf("callback status got: %v want: %v, body: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got == nil || got.AccessToken.Reveal() != "ghu_abc" || got.RefreshToken.Reveal() != "ghr_abc" {
+		t.Errorf("OnToken got: %+v", got)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected state cookie to be deleted, got: %v", cookies)
+	}
+}
+
+func TestWebFlowNoCookie(t *testing.T) {
+	var gotErr error
+	flow := NewWebFlow("Iv1.abc", "secret", "https://example.com/oauth/callback", nil)
+	flow.OnError = func(w http.ResponseWriter, r *http.Request, err error) {
+		gotErr = err
+	}
+	flow.CallbackHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/oauth/callback?code=code&state=state", nil))
+	if !errors.Is(gotErr, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got: %v", gotErr)
+	}
+}
@@ -0,0 +1,198 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+)
+
+// DefaultDeliveryTTL is how long a MemoryDeliveryStore remembers deliveries by
+// default, matching how long GitHub allows deliveries to be redelivered.
+const DefaultDeliveryTTL = 72 * time.Hour
+
+var (
+	// ErrDuplicateDelivery is returned when a delivery has already been
+	// handled.
+	ErrDuplicateDelivery = errors.New("webhook: duplicate delivery")
+	// ErrMissingDeliveryID is returned when a delivery has no
+	// X-GitHub-Delivery header and deliveries are being deduplicated.
+	ErrMissingDeliveryID = errors.New("webhook: missing X-GitHub-Delivery header")
+)
+
+// DeliveryStore records the IDs of webhook deliveries which have been handled.
+// Implementations must be safe to be used concurrently, and should be shared
+// by all replicas of a service, such as by using a database.
+type DeliveryStore interface {
+	// Add records deliveryID, returning false if it was already recorded. It
+	// must check and record the delivery atomically.
+	Add(ctx context.Context, deliveryID string) (added bool, err error)
+	// Remove removes deliveryID, so a redelivery is accepted.
+	Remove(ctx context.Context, deliveryID string) error
+}
+
+// MemoryDeliveryStore is a DeliveryStore which remembers deliveries in memory
+// for TTL.
+type MemoryDeliveryStore struct {
+	TTL   time.Duration        // TTL is how long deliveries are remembered, defaults to DefaultDeliveryTTL
+	Clock ghinstallation.Clock // Clock provides the current time, defaults to the system clock
+
+	mu       sync.Mutex
+	expiries map[string]time.Time
+	pruned   time.Time
+}
+
+var _ DeliveryStore = &MemoryDeliveryStore{}
+
+// NewMemoryDeliveryStore returns a MemoryDeliveryStore remembering deliveries
+// for ttl.
+func NewMemoryDeliveryStore(ttl time.Duration) *MemoryDeliveryStore {
+	return &MemoryDeliveryStore{TTL: ttl}
+}
+
+// Add implements DeliveryStore.
+func (s *MemoryDeliveryStore) Add(_ context.Context, deliveryID string) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	if exp, ok := s.expiries[deliveryID]; ok && now.Before(exp) {
+		return false, nil
+	}
+	if s.expiries == nil {
+		s.expiries = make(map[string]time.Time)
+	}
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultDeliveryTTL
+	}
+	s.expiries[deliveryID] = now.Add(ttl)
+	return true, nil
+}
+
+// Remove implements DeliveryStore.
+func (s *MemoryDeliveryStore) Remove(_ context.Context, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expiries, deliveryID)
+	return nil
+}
+
+// Len returns the number of deliveries remembered.
+func (s *MemoryDeliveryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(s.now())
+	return len(s.expiries)
+}
+
+// prune removes expired deliveries, at most once a minute. s.mu must be held.
+func (s *MemoryDeliveryStore) prune(now time.Time) {
+	if now.Sub(s.pruned) < time.Minute {
+		return
+	}
+	s.pruned = now
+	for id, exp := range s.expiries {
+		if !now.Before(exp) {
+			delete(s.expiries, id)
+		}
+	}
+}
+
+func (s *MemoryDeliveryStore) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+	return s.Clock.Now()
+}
+
+// DeduplicatorStats are the number of deliveries checked by a Deduplicator.
+type DeduplicatorStats struct {
+	Accepted   int64 // Accepted is the number of deliveries not seen before
+	Duplicates int64 // Duplicates is the number of deliveries rejected as duplicates
+}
+
+// Deduplicator prevents webhook deliveries which have already been handled,
+// such as redeliveries or replays of captured deliveries, from being handled
+// again, by recording their X-GitHub-Delivery IDs in a DeliveryStore.
+//
+// Duplicate deliveries are acknowledged with 200 OK by default, as GitHub
+// records any other status as a failed delivery, so an event which was handled
+// but marked failed, such as after a slow response, would otherwise fail on
+// every redelivery. Deliveries which fail with a 5xx status code are removed
+// from the store, so they can be redelivered.
+type Deduplicator struct {
+	Store           DeliveryStore // Store records handled deliveries
+	DuplicateStatus int           // DuplicateStatus, if set, is the status code Handler responds to duplicate deliveries with, such as 409 Conflict, defaults to 200 OK
+
+	accepted   atomic.Int64
+	duplicates atomic.Int64
+}
+
+// NewDeduplicator returns a Deduplicator recording deliveries in store.
+func NewDeduplicator(store DeliveryStore) *Deduplicator {
+	return &Deduplicator{Store: store}
+}
+
+// Stats returns the number of deliveries checked.
+func (d *Deduplicator) Stats() DeduplicatorStats {
+	return DeduplicatorStats{
+		Accepted:   d.accepted.Load(),
+		Duplicates: d.duplicates.Load(),
+	}
+}
+
+// Check records event's delivery, returning ErrDuplicateDelivery if it has
+// already been recorded. The event must have been verified, so unauthenticated
+// requests cannot add to the store.
+func (d *Deduplicator) Check(ctx context.Context, event *Event) error {
+	if event.DeliveryID == "" {
+		return ErrMissingDeliveryID
+	}
+	added, err := d.Store.Add(ctx, event.DeliveryID)
+	if err != nil {
+		return err
+	}
+	if !added {
+		d.duplicates.Add(1)
+		return ErrDuplicateDelivery
+	}
+	d.accepted.Add(1)
+	return nil
+}
+
+// Forget removes event's delivery from the store, so a redelivery is
+// accepted.
+func (d *Deduplicator) Forget(ctx context.Context, event *Event) error {
+	return d.Store.Remove(ctx, event.DeliveryID)
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Unwrap allows http.ResponseController to access the underlying
+// ResponseWriter.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
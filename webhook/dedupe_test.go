@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a ghinstallation.Clock whose time only changes when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestMemoryDeliveryStore(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryDeliveryStore(time.Hour)
+	s.Clock = clock
+
+	add := func(id string, want bool) {
+		t.Helper()
+		added, err := s.Add(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != want {
+			t.Errorf("Add(%q) at %v got: %v want: %v", id, clock.Now().Format(time.TimeOnly), added, want)
+		}
+	}
+	add("a", true)
+	add("a", false)
+	clock.Advance(30 * time.Minute)
+	add("b", true)
+	add("a", false)
+	clock.Advance(31 * time.Minute)
+	add("a", true) // expired
+	if n := s.Len(); n != 2 {
+		t.Errorf("Len got: %d want: 2", n)
+	}
+	clock.Advance(2 * time.Hour)
+	if n := s.Len(); n != 0 {
+		t.Errorf("Len after expiry got: %d want: 0", n)
+	}
+
+	add("c", true)
+	if err := s.Remove(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	add("c", true)
+}
+
+func TestHandlerDeduplicator(t *testing.T) {
+	status := http.StatusOK
+	var calls int
+	h := NewHandler(NewVerifier("secret"), nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	h.Deduplicator = NewDeduplicator(NewMemoryDeliveryStore(time.Hour))
+
+	deliver := func(deliveryID string) int {
+		t.Helper()
+		r := newDelivery("push", "application/json", pushPayload, sign("secret", pushPayload))
+		r.Header.Set("X-GitHub-Delivery", deliveryID)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	for _, tc := range []struct {
+		deliveryID    string
+		handlerStatus int
+		want          int
+	}{
+		{"1", http.StatusOK, http.StatusOK},
+		{"1", http.StatusOK, http.StatusOK}, // acknowledged without handling
+		{"2", http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		{"2", http.StatusOK, http.StatusOK}, // redelivery after failure
+		{"2", http.StatusOK, http.StatusOK},
+		{"", http.StatusOK, http.StatusBadRequest},
+	} {
+		status = tc.handlerStatus
+		if got := deliver(tc.deliveryID); got != tc.want {
+			t.Errorf("delivery %q status got: %d want: %d", tc.deliveryID, got, tc.want)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("handler called %d times want 3", calls)
+	}
+	if got, want := h.Deduplicator.Stats(), (DeduplicatorStats{Accepted: 3, Duplicates: 2}); got != want {
+		t.Errorf("Stats got: %+v want: %+v", got, want)
+	}
+
+	// Duplicates can be rejected instead, such as when not expecting
+	// redeliveries.
+	h.Deduplicator.DuplicateStatus = http.StatusConflict
+	if got := deliver("1"); got != http.StatusConflict {
+		t.Errorf("duplicate delivery with DuplicateStatus got: %d want: %d", got, http.StatusConflict)
+	}
+	if got := h.Deduplicator.Stats().Duplicates; got != 3 {
+		t.Errorf("Duplicates got: %d want: 3", got)
+	}
+	if calls != 3 {
+		t.Errorf("handler called %d times want 3", calls)
+	}
+
+	// Deliveries with invalid signatures are not recorded.
+	r := newDelivery("push", "application/json", pushPayload, sign("wrong", pushPayload))
+	r.Header.Set("X-GitHub-Delivery", "3")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got := deliver("3"); got != http.StatusOK {
+		t.Errorf("delivery after forged delivery status got: %d want: %d", got, http.StatusOK)
+	}
+}
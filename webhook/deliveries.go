@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v88/github"
+)
+
+// maxDeliveriesPerPage is the largest page of deliveries returned by GitHub.
+const maxDeliveriesPerPage = 100
+
+// Deliveries inspects and redelivers the deliveries of the GitHub App's
+// webhook, using the app hook delivery API authenticated as the app. GitHub
+// keeps deliveries for 3 days.
+type Deliveries struct {
+	Client *github.Client // Client is authenticated as the GitHub App
+}
+
+// NewDeliveries returns a Deliveries authenticating as the GitHub App using
+// atr.
+func NewDeliveries(atr *ghinstallation.AppsTransport) (*Deliveries, error) {
+	client, err := newGitHubClient(&http.Client{Transport: atr}, atr.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Deliveries{Client: client}, nil
+}
+
+// List returns a page of deliveries, most recent first, starting at cursor,
+// or the first page if cursor is empty. next is the cursor of the following
+// page, or empty if there are no more deliveries.
+//
+// Deliveries returned by List do not include their request and response, use
+// Get to fetch them.
+func (d *Deliveries) List(ctx context.Context, cursor string, perPage int) (deliveries []*github.HookDelivery, next string, err error) {
+	deliveries, resp, err := d.Client.Apps.ListHookDeliveries(ctx, &github.ListCursorOptions{Cursor: cursor, PerPage: perPage})
+	if err != nil {
+		return nil, "", fmt.Errorf("could not list hook deliveries: %w", err)
+	}
+	return deliveries, resp.Cursor, nil
+}
+
+// Since returns the deliveries delivered at or after since, most recent first,
+// fetching as many pages as necessary.
+func (d *Deliveries) Since(ctx context.Context, since time.Time) ([]*github.HookDelivery, error) {
+	var all []*github.HookDelivery
+	cursor := ""
+	for {
+		deliveries, next, err := d.List(ctx, cursor, maxDeliveriesPerPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, delivery := range deliveries {
+			if delivery.GetDeliveredAt().Before(since) {
+				return all, nil
+			}
+			all = append(all, delivery)
+		}
+		if next == "" {
+			return all, nil
+		}
+		cursor = next
+	}
+}
+
+// Get returns a delivery, including its request and response.
+func (d *Deliveries) Get(ctx context.Context, deliveryID int64) (*github.HookDelivery, error) {
+	delivery, _, err := d.Client.Apps.GetHookDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get hook delivery %d: %w", deliveryID, err)
+	}
+	return delivery, nil
+}
+
+// Redeliver asks GitHub to redeliver a delivery. The redelivery is made
+// asynchronously, with the same X-GitHub-Delivery GUID as the original.
+func (d *Deliveries) Redeliver(ctx context.Context, deliveryID int64) error {
+	_, _, err := d.Client.Apps.RedeliverHookDelivery(ctx, deliveryID)
+	var accepted *github.AcceptedError
+	if err != nil && !errors.As(err, &accepted) {
+		return fmt.Errorf("could not redeliver hook delivery %d: %w", deliveryID, err)
+	}
+	return nil
+}
+
+// RedeliverFailed redelivers the events whose deliveries since since failed,
+// such as during an outage, and returns the deliveries redelivered. An event
+// is redelivered at most once, and not at all if any delivery of the event,
+// identified by its GUID, succeeded. Redelivery continues if redelivering an
+// event fails, and all such errors are returned.
+func (d *Deliveries) RedeliverFailed(ctx context.Context, since time.Time) ([]*github.HookDelivery, error) {
+	deliveries, err := d.Since(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	succeeded := make(map[string]bool)
+	for _, delivery := range deliveries {
+		if delivered(delivery) {
+			succeeded[delivery.GetGUID()] = true
+		}
+	}
+
+	var redelivered []*github.HookDelivery
+	var errs []error
+	seen := make(map[string]bool)
+	// Deliveries are most recent first, so the latest failed attempt of each
+	// event is redelivered.
+	for _, delivery := range deliveries {
+		guid := delivery.GetGUID()
+		if succeeded[guid] || seen[guid] {
+			continue
+		}
+		seen[guid] = true
+		if err := d.Redeliver(ctx, delivery.GetID()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		redelivered = append(redelivered, delivery)
+	}
+	return redelivered, errors.Join(errs...)
+}
+
+// delivered reports whether a delivery was successful.
+func delivered(delivery *github.HookDelivery) bool {
+	code := delivery.GetStatusCode()
+	return code >= 200 && code < 300
+}
@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v88/github"
+)
+
+// fakeDeliveries serves the app hook delivery API from deliveries, most recent
+// first, two per page.
+type fakeDeliveries struct {
+	t          *testing.T
+	deliveries []*github.HookDelivery
+
+	mu          sync.Mutex
+	redelivered []int64
+}
+
+func (f *fakeDeliveries) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		f.t.Errorf("%s %s not authenticated as app", r.Method, r.URL.Path)
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/app/hook/deliveries":
+		start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		end := min(start+2, len(f.deliveries))
+		if end < len(f.deliveries) {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/app/hook/deliveries?cursor=%d>; rel="next"`, r.Host, end))
+		}
+		_ = json.NewEncoder(w).Encode(f.deliveries[start:end])
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/app/hook/deliveries/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/app/hook/deliveries/"), 10, 64)
+		for _, d := range f.deliveries {
+			if d.GetID() == id {
+				delivery := *d
+				delivery.Request = &github.HookRequest{Headers: map[string]string{"X-GitHub-Event": d.GetEvent()}}
+				_ = json.NewEncoder(w).Encode(delivery)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/attempts"):
+		id, _ := strconv.ParseInt(strings.Split(r.URL.Path, "/")[4], 10, 64)
+		f.mu.Lock()
+		f.redelivered = append(f.redelivered, id)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "{}")
+	default:
+		f.t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	delivery := func(id int64, guid string, status int, age time.Duration) *github.HookDelivery {
+		return &github.HookDelivery{
+			ID:          github.Ptr(id),
+			GUID:        github.Ptr(guid),
+			StatusCode:  github.Ptr(status),
+			Event:       github.Ptr("push"),
+			DeliveredAt: &github.Timestamp{Time: now.Add(-age)},
+		}
+	}
+	fake := &fakeDeliveries{t: t, deliveries: []*github.HookDelivery{
+		delivery(7, "c", 502, time.Minute),   // redelivery of c failed again
+		delivery(6, "b", 200, 2*time.Minute), // redelivery of b succeeded
+		delivery(5, "d", 0, 3*time.Minute),   // timed out
+		delivery(4, "c", 502, 4*time.Minute), // c failed
+		delivery(3, "b", 500, 5*time.Minute), // b failed
+		delivery(2, "a", 200, 6*time.Minute), // a succeeded
+		delivery(1, "e", 500, 2*time.Hour),   // too old
+	}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atr := ghinstallation.NewAppsTransportFromPrivateKey(http.DefaultTransport, 1, key)
+	atr.BaseURL = ts.URL
+	d, err := NewDeliveries(atr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	page, next, err := d.List(ctx, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].GetID() != 7 || next != "2" {
+		t.Errorf("List got %d deliveries, first %d, next %q", len(page), page[0].GetID(), next)
+	}
+
+	since, err := d.Since(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(since) != 6 {
+		t.Errorf("Since got %d deliveries want 6", len(since))
+	}
+
+	got, err := d.Get(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetGUID() != "c" || got.GetRequest().GetHeader("X-GitHub-Event") != "push" {
+		t.Errorf("Get got: %v", got)
+	}
+
+	redelivered, err := d.RedeliverFailed(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, r := range redelivered {
+		ids = append(ids, r.GetID())
+	}
+	if want := []int64{7, 5}; fmt.Sprint(ids) != fmt.Sprint(want) || fmt.Sprint(fake.redelivered) != fmt.Sprint(want) {
+		t.Errorf("redelivered got: %v, server got: %v want: %v", ids, fake.redelivered, want)
+	}
+}
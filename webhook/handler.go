@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v88/github"
+)
+
+// Handler is an http.Handler receiving webhook deliveries. It verifies and
+// parses each delivery, then calls the wrapped handler with a request whose
+// context contains the Event and, for events delivered for an installation,
+// clients authenticated as that installation. Use EventFromContext,
+// ClientFromContext and HTTPClientFromContext to retrieve them.
+//
+// Invalid deliveries are rejected with the status code returned by
+// StatusCode, without calling the wrapped handler. If Deduplicator is set,
+// deliveries which have already been handled are acknowledged without calling
+// the wrapped handler.
+//
+// If Lifecycle is set, it is updated with installation events before the
+// wrapped handler is called. Clients are not provided for events deleting or
+// suspending an installation, as it can no longer be authenticated as.
+type Handler struct {
+	Verifier      *Verifier                     // Verifier verifies and parses deliveries
+	Installations *ghinstallation.Installations // Installations provides the Transport of each installation
+	Deduplicator  *Deduplicator                 // Deduplicator, if set, rejects deliveries which have already been handled
+	Lifecycle     *Lifecycle                    // Lifecycle, if set, tracks changes to installations
+	Handler       http.Handler                  // Handler handles verified deliveries
+}
+
+var _ http.Handler = &Handler{}
+
+// NewHandler returns a Handler verifying deliveries with v, and calling h with
+// clients for the event's installation from installations.
+func NewHandler(v *Verifier, installations *ghinstallation.Installations, h http.Handler) *Handler {
+	return &Handler{
+		Verifier:      v,
+		Installations: installations,
+		Handler:       h,
+	}
+}
+
+type contextKey int
+
+const (
+	eventKey contextKey = iota
+	clientKey
+	httpClientKey
+)
+
+// ServeHTTP implements http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	event, err := h.Verifier.Parse(r)
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return
+	}
+	if h.Deduplicator != nil {
+		if err := h.Deduplicator.Check(r.Context(), event); err != nil {
+			status := StatusCode(err)
+			switch {
+			case errors.Is(err, ErrDuplicateDelivery):
+				if h.Deduplicator.DuplicateStatus != 0 {
+					status = h.Deduplicator.DuplicateStatus
+				}
+			case !errors.Is(err, ErrMissingDeliveryID):
+				status = http.StatusInternalServerError
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	if h.Lifecycle != nil {
+		h.Lifecycle.Handle(event)
+	}
+
+	ctx := context.WithValue(r.Context(), eventKey, event)
+	if event.InstallationID != 0 && h.Installations != nil && !removesInstallation(event) {
+		tr := h.Installations.Transport(event.InstallationID)
+		httpClient := ghinstallation.NewHTTPClient(tr)
+		client, err := newGitHubClient(httpClient, tr.BaseURL)
+		if err != nil {
+			h.forget(r.Context(), event)
+			http.Error(w, "webhook: could not create GitHub client", http.StatusInternalServerError)
+			return
+		}
+		ctx = context.WithValue(ctx, httpClientKey, httpClient)
+		ctx = context.WithValue(ctx, clientKey, client)
+	}
+
+	rec := &statusRecorder{ResponseWriter: w}
+	h.Handler.ServeHTTP(rec, r.WithContext(ctx))
+	if rec.status >= 500 {
+		h.forget(r.Context(), event)
+	}
+}
+
+// forget removes event's delivery from the Deduplicator, if any, after it
+// failed to be handled, so it can be redelivered.
+func (h *Handler) forget(ctx context.Context, event *Event) {
+	if h.Deduplicator != nil {
+		_ = h.Deduplicator.Forget(ctx, event)
+	}
+}
+
+// EventFromContext returns the Event of the delivery being handled by a
+// Handler.
+func EventFromContext(ctx context.Context) (*Event, bool) {
+	event, ok := ctx.Value(eventKey).(*Event)
+	return event, ok
+}
+
+// ClientFromContext returns a go-github client authenticated as the
+// installation the event being handled by a Handler was delivered for. It
+// returns false for events not delivered for an installation, such as ping
+// events for the app's webhook.
+func ClientFromContext(ctx context.Context) (*github.Client, bool) {
+	client, ok := ctx.Value(clientKey).(*github.Client)
+	return client, ok
+}
+
+// HTTPClientFromContext returns an *http.Client authenticated as the
+// installation the event being handled by a Handler was delivered for. It
+// returns false for events not delivered for an installation.
+func HTTPClientFromContext(ctx context.Context) (*http.Client, bool) {
+	client, ok := ctx.Value(httpClientKey).(*http.Client)
+	return client, ok
+}
+
+// newGitHubClient returns a go-github client sending requests with httpClient
+// to the API at baseURL.
+func newGitHubClient(httpClient *http.Client, baseURL string) (*github.Client, error) {
+	opts := []github.ClientOptionsFunc{github.WithHTTPClient(httpClient)}
+	if baseURL != "" && strings.TrimRight(baseURL, "/") != "https://api.github.com" {
+		base := strings.TrimRight(baseURL, "/") + "/"
+		upload := uploadURL(base)
+		opts = append(opts, github.WithURLs(&base, &upload))
+	}
+	return github.NewClient(opts...)
+}
+
+// uploadURL returns the uploads URL of the API at baseURL. GHE.com serves
+// uploads from a sibling of the API host, and GitHub Enterprise Server from
+// /api/uploads.
+func uploadURL(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL
+	}
+	if domain, ok := strings.CutPrefix(u.Host, "api."); ok {
+		u.Host = "uploads." + domain
+		u.Path = "/"
+	} else if prefix, ok := strings.CutSuffix(u.Path, "/api/v3/"); ok {
+		u.Path = prefix + "/api/uploads/"
+	}
+	return u.String()
+}
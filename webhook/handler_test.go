@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/bradleyfalzon/ghinstallation/v2/ghinstallationtest"
+)
+
+func TestHandler(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := ghinstallationtest.NewServer()
+	defer srv.Close()
+	srv.AddApp(ghinstallationtest.App{ID: 1, PublicKey: &key.PublicKey})
+	srv.AddInstallation(ghinstallationtest.Installation{
+		ID:           42,
+		AppID:        1,
+		Account:      "octo-org",
+		Repositories: []ghinstallationtest.Repository{{ID: 10, Name: "hello-world"}},
+	})
+
+	atr := ghinstallation.NewAppsTransportFromPrivateKey(http.DefaultTransport, 1, key)
+	atr.BaseURL = srv.URL
+	installations := ghinstallation.NewInstallations(atr)
+
+	var got string
+	h := NewHandler(NewVerifier("secret"), installations, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event, ok := EventFromContext(r.Context())
+		if !ok {
+			t.Fatal("no event in context")
+		}
+		client, ok := ClientFromContext(r.Context())
+		if !ok {
+			got = event.Type
+			return
+		}
+		if _, ok := HTTPClientFromContext(r.Context()); !ok {
+			t.Error("no HTTP client in context")
+		}
+		repos, _, err := client.Apps.ListRepos(r.Context(), nil)
+		if err != nil {
+			t.Fatalf("ListRepos: %v", err)
+		}
+		got = fmt.Sprintf("%s %d %s", event.Type, event.InstallationID, repos.Repositories[0].GetFullName())
+	}))
+
+	for _, tc := range []struct {
+		eventType string
+		payload   string
+		want      string
+	}{
+		{"push", pushPayload, "push 42 octo-org/hello-world"},
+		{"ping", `{"zen":"Keep it logically awesome."}`, "ping"},
+	} {
+		got = ""
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newDelivery(tc.eventType, "application/json", tc.payload, sign("secret", tc.payload)))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status got: %d want: %d: %s", tc.eventType, rec.Code, http.StatusOK, rec.Body)
+		}
+		if got != tc.want {
+			t.Errorf("%s: handler got: %q want: %q", tc.eventType, got, tc.want)
+		}
+	}
+
+	got = ""
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newDelivery("push", "application/json", pushPayload, sign("wrong", pushPayload)))
+	if rec.Code != http.StatusUnauthorized || got != "" {
+		t.Errorf("invalid signature: status got: %d, handler called: %v", rec.Code, got != "")
+	}
+}
+
+func TestHandlerContextWithoutEvent(t *testing.T) {
+	if _, ok := EventFromContext(context.Background()); ok {
+		t.Error("EventFromContext returned an event for an empty context")
+	}
+	if _, ok := ClientFromContext(context.Background()); ok {
+		t.Error("ClientFromContext returned a client for an empty context")
+	}
+}
+
+func TestUploadURL(t *testing.T) {
+	for _, tc := range []struct{ base, want string }{
+		{"https://github.example.com/api/v3/", "https://github.example.com/api/uploads/"},
+		{"https://api.octocorp.ghe.com/", "https://uploads.octocorp.ghe.com/"},
+		{"http://127.0.0.1:8080/", "http://127.0.0.1:8080/"},
+	} {
+		if got := uploadURL(tc.base); got != tc.want {
+			t.Errorf("uploadURL(%q) got: %q want: %q", tc.base, got, tc.want)
+		}
+	}
+	if _, err := newGitHubClient(http.DefaultClient, "https://api.github.com"); err != nil {
+		t.Errorf("newGitHubClient: %v", err)
+	}
+}
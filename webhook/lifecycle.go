@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"sync"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v88/github"
+)
+
+// LifecycleEvent is a change to an installation of the GitHub App, reported by
+// an installation or installation_repositories webhook event.
+type LifecycleEvent struct {
+	Action         string // Action is the event's action, such as "created", "deleted", "suspend", "unsuspend", "new_permissions_accepted", "added" or "removed"
+	InstallationID int64  // InstallationID is the ID of the changed installation
+	Event          *Event // Event is the webhook event reporting the change
+}
+
+// Lifecycle keeps an Installations consistent with changes to the GitHub App's
+// installations, reported by webhook events, and notifies subscribers of the
+// changes:
+//
+//   - the Transports of deleted and suspended installations are forgotten
+//   - the tokens of installations which accepted new permissions, or whose
+//     repositories were added or removed, are invalidated
+//
+// Lifecycle is safe to be used concurrently.
+type Lifecycle struct {
+	Installations *ghinstallation.Installations // Installations is updated with changes to installations
+
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]func(LifecycleEvent)
+}
+
+// NewLifecycle returns a Lifecycle updating installations.
+func NewLifecycle(installations *ghinstallation.Installations) *Lifecycle {
+	return &Lifecycle{Installations: installations}
+}
+
+// Subscribe calls fn with each change to an installation, after Installations
+// has been updated. fn is called synchronously by Handle, so it should not
+// block. Call the returned function to unsubscribe.
+func (l *Lifecycle) Subscribe(fn func(LifecycleEvent)) (unsubscribe func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subscribers == nil {
+		l.subscribers = make(map[int]func(LifecycleEvent))
+	}
+	id := l.nextID
+	l.nextID++
+	l.subscribers[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers, id)
+	}
+}
+
+// Handle updates Installations and notifies subscribers if event is an
+// installation or installation_repositories event. It reports whether event
+// was such an event.
+func (l *Lifecycle) Handle(event *Event) bool {
+	var action string
+	switch payload := event.Payload.(type) {
+	case *github.InstallationEvent:
+		action = payload.GetAction()
+	case *github.InstallationRepositoriesEvent:
+		action = payload.GetAction()
+	default:
+		return false
+	}
+	if event.InstallationID == 0 {
+		return false
+	}
+
+	if l.Installations != nil {
+		switch {
+		case removesInstallation(event):
+			l.Installations.Forget(event.InstallationID)
+		case event.Type == "installation_repositories", action == "new_permissions_accepted":
+			l.Installations.Invalidate(event.InstallationID)
+		}
+	}
+
+	l.mu.Lock()
+	subscribers := make([]func(LifecycleEvent), 0, len(l.subscribers))
+	for _, fn := range l.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	l.mu.Unlock()
+
+	le := LifecycleEvent{Action: action, InstallationID: event.InstallationID, Event: event}
+	for _, fn := range subscribers {
+		fn(le)
+	}
+	return true
+}
+
+// removesInstallation reports whether event is for an installation being
+// deleted or suspended, which can no longer be authenticated as.
+func removesInstallation(event *Event) bool {
+	payload, ok := event.Payload.(*github.InstallationEvent)
+	if !ok {
+		return false
+	}
+	switch payload.GetAction() {
+	case "deleted", "suspend":
+		return true
+	}
+	return false
+}
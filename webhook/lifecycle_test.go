@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/bradleyfalzon/ghinstallation/v2/ghinstallationtest"
+)
+
+func TestLifecycle(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := ghinstallationtest.NewServer()
+	defer srv.Close()
+	srv.AddApp(ghinstallationtest.App{ID: 1, PublicKey: &key.PublicKey})
+	srv.AddInstallation(ghinstallationtest.Installation{ID: 42, AppID: 1, Account: "octo-org"})
+
+	atr := ghinstallation.NewAppsTransportFromPrivateKey(http.DefaultTransport, 1, key)
+	atr.BaseURL = srv.URL
+	installations := ghinstallation.NewInstallations(atr)
+
+	var handled []string
+	h := NewHandler(NewVerifier("secret"), installations, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := ClientFromContext(r.Context())
+		handled = append(handled, fmt.Sprintf("client:%v", ok))
+	}))
+	h.Lifecycle = NewLifecycle(installations)
+	var notified []string
+	unsubscribe := h.Lifecycle.Subscribe(func(ev LifecycleEvent) {
+		notified = append(notified, fmt.Sprintf("%s %d", ev.Action, ev.InstallationID))
+	})
+
+	deliver := func(eventType, action string) {
+		t.Helper()
+		payload := fmt.Sprintf(`{"action":%q,"installation":{"id":42}}`, action)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newDelivery(eventType, "application/json", payload, sign("secret", payload)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status got: %d want: %d", eventType, action, rec.Code, http.StatusOK)
+		}
+	}
+	token := func(tr *ghinstallation.Transport) string {
+		t.Helper()
+		tok, err := tr.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+
+	tr := installations.Transport(42)
+	first := token(tr)
+	deliver("installation", "new_permissions_accepted")
+	if token(tr) == first {
+		t.Error("token was not invalidated after new_permissions_accepted")
+	}
+	second := token(tr)
+	deliver("installation_repositories", "added")
+	if token(tr) == second {
+		t.Error("token was not invalidated after repositories were added")
+	}
+
+	deliver("installation", "deleted")
+	if installations.Transport(42) == tr {
+		t.Error("Transport of deleted installation was not forgotten")
+	}
+
+	unsubscribe()
+	deliver("installation", "created")
+
+	want := []string{"new_permissions_accepted 42", "added 42", "deleted 42"}
+	if fmt.Sprint(notified) != fmt.Sprint(want) {
+		t.Errorf("notified got: %v want: %v", notified, want)
+	}
+	wantHandled := []string{"client:true", "client:true", "client:false", "client:true"}
+	if fmt.Sprint(handled) != fmt.Sprint(wantHandled) {
+		t.Errorf("handled got: %v want: %v", handled, wantHandled)
+	}
+}
+
+func TestLifecycleIgnoresOtherEvents(t *testing.T) {
+	event, err := ParseEvent("push", "1", []byte(pushPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NewLifecycle(nil).Handle(event) {
+		t.Error("Handle reported a push event as a lifecycle event")
+	}
+}
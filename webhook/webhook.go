@@ -0,0 +1,228 @@
+// Package webhook verifies and parses webhooks delivered by GitHub to a GitHub
+// App.
+//
+// Deliveries are authenticated using the X-Hub-Signature-256 header, an
+// HMAC-SHA256 of the body keyed with the webhook secret, before the payload
+// is parsed into a go-github event type.
+//
+//	v := webhook.NewVerifier(ghinstallation.Secret(os.Getenv("WEBHOOK_SECRET")))
+//	http.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
+//		event, err := v.Parse(r)
+//		if err != nil {
+//			http.Error(w, err.Error(), webhook.StatusCode(err))
+//			return
+//		}
+//		switch payload := event.Payload.(type) {
+//		case *github.PushEvent:
+//			...
+//		}
+//	})
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v88/github"
+)
+
+const (
+	// DefaultMaxBodySize is the default limit of the size of a delivery's
+	// body, matching the largest payload GitHub delivers.
+	DefaultMaxBodySize = 25 << 20
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	// ErrMissingSignature is returned when a delivery has no
+	// X-Hub-Signature-256 header.
+	ErrMissingSignature = errors.New("webhook: missing X-Hub-Signature-256 header")
+	// ErrInvalidSignature is returned when a delivery's signature does not
+	// match any of the secrets.
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	// ErrBodyTooLarge is returned when a delivery's body exceeds MaxBodySize.
+	ErrBodyTooLarge = errors.New("webhook: body too large")
+)
+
+// Event is a verified webhook delivery.
+type Event struct {
+	Type           string      // Type is the event type, from the X-GitHub-Event header, such as "push"
+	DeliveryID     string      // DeliveryID is the unique ID of the delivery, from the X-GitHub-Delivery header
+	InstallationID int64       // InstallationID is the ID of the installation the event was delivered for, or zero if none
+	Payload        interface{} // Payload is the parsed payload, such as *github.PushEvent, or nil for event types unknown to go-github
+	Body           []byte      // Body is the JSON payload
+}
+
+// Verifier verifies webhook deliveries. A delivery is accepted if it is signed
+// with any of the secrets, allowing secrets to be rotated without downtime:
+// add the new secret, update the GitHub App's webhook secret, then remove the
+// old secret.
+//
+// Verifier is safe to be used concurrently.
+type Verifier struct {
+	Secrets     []ghinstallation.Secret // Secrets are the accepted webhook secrets
+	MaxBodySize int64                   // MaxBodySize limits the size of a delivery's body, defaults to DefaultMaxBodySize
+}
+
+// NewVerifier returns a Verifier accepting deliveries signed with any of
+// secrets.
+func NewVerifier(secrets ...ghinstallation.Secret) *Verifier {
+	return &Verifier{
+		Secrets:     secrets,
+		MaxBodySize: DefaultMaxBodySize,
+	}
+}
+
+// Verify returns nil if signature, the value of the X-Hub-Signature-256
+// header, is a valid signature of body with any of the secrets. Signatures are
+// compared in constant time.
+func (v *Verifier) Verify(signature string, body []byte) error {
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	hexMAC, ok := strings.CutPrefix(signature, signaturePrefix)
+	if !ok {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(hexMAC)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	valid := false
+	for _, secret := range v.Secrets {
+		if secret == "" {
+			continue
+		}
+		mac := hmac.New(sha256.New, []byte(secret.Reveal()))
+		mac.Write(body)
+		if hmac.Equal(got, mac.Sum(nil)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Parse reads and verifies the delivery r, and parses its payload. The body
+// may be JSON or form encoded, as configured for the GitHub App's webhook.
+func (v *Verifier) Parse(r *http.Request) (*Event, error) {
+	signature := r.Header.Get(github.SHA256SignatureHeader)
+	if signature == "" {
+		return nil, ErrMissingSignature
+	}
+	body, err := v.readBody(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Verify(signature, body); err != nil {
+		return nil, err
+	}
+
+	payload, err := jsonPayload(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEvent(github.WebHookType(r), github.DeliveryID(r), payload)
+}
+
+// ParseEvent parses a webhook's JSON payload of the event type, which has
+// already been verified.
+func ParseEvent(eventType, deliveryID string, payload []byte) (*Event, error) {
+	if eventType == "" {
+		return nil, fmt.Errorf("webhook: missing %s header", github.EventTypeHeader)
+	}
+	var p struct {
+		Installation *struct {
+			ID int64 `json:"id"`
+		} `json:"installation"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("webhook: could not parse payload: %w", err)
+	}
+
+	event := &Event{
+		Type:       eventType,
+		DeliveryID: deliveryID,
+		Body:       payload,
+	}
+	if p.Installation != nil {
+		event.InstallationID = p.Installation.ID
+	}
+	if github.EventForType(eventType) != nil {
+		parsed, err := github.ParseWebHook(eventType, payload)
+		if err != nil {
+			return nil, fmt.Errorf("webhook: could not parse %s payload: %w", eventType, err)
+		}
+		event.Payload = parsed
+	}
+	return event, nil
+}
+
+// StatusCode returns the HTTP status code to respond with when Parse or
+// Deduplicator.Check returns err. Duplicate deliveries are acknowledged with
+// 200 OK, so GitHub records redeliveries of handled events as successful.
+func StatusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrMissingSignature), errors.Is(err, ErrInvalidSignature):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrDuplicateDelivery):
+		return http.StatusOK
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// readBody reads the body of a delivery, returning ErrBodyTooLarge if it
+// exceeds MaxBodySize.
+func (v *Verifier) readBody(r io.Reader) ([]byte, error) {
+	limit := v.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("webhook: could not read body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+// jsonPayload returns the JSON payload of a delivery's body.
+func jsonPayload(contentType string, body []byte) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("webhook: invalid Content-Type %q: %w", contentType, err)
+	}
+	switch mediaType {
+	case "application/json":
+		return body, nil
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("webhook: could not parse form: %w", err)
+		}
+		return []byte(form.Get("payload")), nil
+	default:
+		return nil, fmt.Errorf("webhook: unsupported Content-Type %q", contentType)
+	}
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+)
+
+const pushPayload = `{"ref":"refs/heads/main","installation":{"id":42},"repository":{"full_name":"octo-org/hello-world"}}`
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDelivery(eventType, contentType, body, signature string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set(github.EventTypeHeader, eventType)
+	r.Header.Set(github.DeliveryIDHeader, "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	if signature != "" {
+		r.Header.Set(github.SHA256SignatureHeader, signature)
+	}
+	return r
+}
+
+func TestParse(t *testing.T) {
+	v := NewVerifier("new-secret", "old-secret")
+
+	for _, secret := range []string{"new-secret", "old-secret"} {
+		event, err := v.Parse(newDelivery("push", "application/json", pushPayload, sign(secret, pushPayload)))
+		if err != nil {
+			t.Fatalf("secret %q: Parse: %v", secret, err)
+		}
+		if event.Type != "push" || event.DeliveryID != "72d3162e-cc78-11e3-81ab-4c9367dc0958" || event.InstallationID != 42 {
+			t.Errorf("event got: %+v", event)
+		}
+		push, ok := event.Payload.(*github.PushEvent)
+		if !ok || push.GetRepo().GetFullName() != "octo-org/hello-world" {
+			t.Errorf("payload got: %#v", event.Payload)
+		}
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	body := url.Values{"payload": {pushPayload}}.Encode()
+	event, err := NewVerifier("secret").Parse(newDelivery("push", "application/x-www-form-urlencoded", body, sign("secret", body)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if event.InstallationID != 42 || !bytes.Equal(event.Body, []byte(pushPayload)) {
+		t.Errorf("event got: %+v", event)
+	}
+}
+
+func TestParseUnknownEvent(t *testing.T) {
+	event, err := NewVerifier("secret").Parse(newDelivery("future_event", "application/json", pushPayload, sign("secret", pushPayload)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if event.Payload != nil || event.InstallationID != 42 {
+		t.Errorf("event got: %+v", event)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	v := NewVerifier("secret")
+	v.MaxBodySize = 64
+
+	for _, tc := range []struct {
+		name   string
+		r      *http.Request
+		err    error
+		status int
+	}{
+		{name: "missing signature", r: newDelivery("push", "application/json", pushPayload, ""), err: ErrMissingSignature, status: http.StatusUnauthorized},
+		{name: "wrong secret", r: newDelivery("push", "application/json", `{}`, sign("wrong", `{}`)), err: ErrInvalidSignature, status: http.StatusUnauthorized},
+		{name: "sha1 signature", r: newDelivery("push", "application/json", `{}`, "sha1=0123"), err: ErrInvalidSignature, status: http.StatusUnauthorized},
+		{name: "malformed signature", r: newDelivery("push", "application/json", `{}`, "sha256=zz"), err: ErrInvalidSignature, status: http.StatusUnauthorized},
+		{name: "body too large", r: newDelivery("push", "application/json", pushPayload, sign("secret", pushPayload)), err: ErrBodyTooLarge, status: http.StatusRequestEntityTooLarge},
+		{name: "invalid json", r: newDelivery("push", "application/json", `{`, sign("secret", `{`)), status: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.Parse(tc.r)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("error got: %v want: %v", err, tc.err)
+			}
+			if got := StatusCode(err); got != tc.status {
+				t.Errorf("StatusCode got: %d want: %d", got, tc.status)
+			}
+		})
+	}
+}
+
+func TestVerifyEmptySecret(t *testing.T) {
+	// An empty secret must never accept deliveries, even if signed with it.
+	if err := NewVerifier("").Verify(sign("", pushPayload), []byte(pushPayload)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify got: %v want: %v", err, ErrInvalidSignature)
+	}
+}